@@ -5,6 +5,8 @@ go 1.24.4
 require (
 	github.com/PuerkitoBio/goquery v1.10.3
 	github.com/chromedp/chromedp v0.14.1
+	golang.org/x/net v0.39.0
+	golang.org/x/text v0.24.0
 )
 
 require (
@@ -15,6 +17,5 @@ require (
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.4.0 // indirect
-	golang.org/x/net v0.39.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
 )
@@ -2,9 +2,12 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -16,8 +19,14 @@ type SiteConfig struct {
 	Name string `json:"name"`
 	// 小说标题选择器列表
 	NovelTitleSelectors []string `json:"novelTitleSelectors"`
+	// 小说作者选择器列表，meta 标签取 content 属性
+	NovelAuthorSelectors []string `json:"novelAuthorSelectors"`
 	// 目录页章节列表选择器
 	ChapterListSelectors []string `json:"chapterListSelectors"`
+	// 目录下一页链接选择器列表
+	CatalogNextPageSelectors []string `json:"catalogNextPageSelectors"`
+	// 目录下一页链接文本关键词，链接文本需要完全匹配
+	CatalogNextPageKeywords []string `json:"catalogNextPageKeywords"`
 	// 章节标题选择器列表
 	ChapterTitleSelectors []string `json:"chapterTitleSelectors"`
 	// 章节内容选择器列表
@@ -26,6 +35,105 @@ type SiteConfig struct {
 	NextChapterSelectors []string `json:"nextChapterSelectors"`
 	// 下一章链接文本关键词
 	NextChapterKeywords []string `json:"nextChapterKeywords"`
+	// 章节分页的URL规则（正则表达式），第一个分组相同的链接属于同一章节，
+	// 例如 ^(.*/\d+)(?:_\d+)?\.html$ 可以把 123.html、123_2.html 识别为同一章节
+	ChapterPagePattern string `json:"chapterPagePattern"`
+	// 章节内下一页链接文本关键词，未配置 chapterPagePattern 时用于区分"下一页"和"下一章"
+	ChapterNextPageKeywords []string `json:"chapterNextPageKeywords"`
+	// 分页提示文本，包含这些文本的段落在拼接时会被去掉
+	ChapterPageMarkers []string `json:"chapterPageMarkers"`
+	// 正文中作者的话所在元素的选择器，例如 .author-say。
+	// 不论是否配置，以"作者有话要说"开头的段落和之后的段落都会被识别为作者的话
+	AuthorNoteSelectors []string `json:"authorNoteSelectors"`
+	// 抓取方式：chromedp（默认）或 http
+	Fetcher string `json:"fetcher"`
+	// 网页编码，例如 gbk、gb18030、big5，未配置时根据响应头、meta 标签和内容自动判断。
+	// 只对 http 抓取方式有效，浏览器会自己处理网页编码
+	Encoding string `json:"encoding"`
+	// 访问频率限制，未配置时使用默认值
+	RateLimit *RateLimitConfig `json:"rateLimit"`
+	// 正文清理规则，未配置时使用默认值
+	Clean *CleanConfig `json:"clean"`
+}
+
+// CleanConfig 正文清理规则。提取正文前先删除正文元素中 removeSelectors 匹配的元素，
+// 提取后依次执行：全角字母数字转为半角、删除匹配的行、正则替换、合并连续的空行
+type CleanConfig struct {
+	// 提取正文前删除的正文中的元素，例如广告和导航
+	RemoveSelectors []string `json:"removeSelectors"`
+	// 包含这些文本的行会被删除
+	RemoveLines []string `json:"removeLines"`
+	// 匹配这些正则表达式的行会被删除
+	RemoveLinePatterns []string `json:"removeLinePatterns"`
+	// 正则替换，按顺序执行，可以去掉夹在正文中的水印
+	Replacements []Replacement `json:"replacements"`
+	// 把全角的字母、数字和网址中常见的符号转为半角，例如 ｗｗｗ．ｅｘａｍｐｌｅ．ｃｏｍ
+	NormalizeWidth bool `json:"normalizeWidth"`
+	// 把连续的多个空行合并为一个
+	CollapseBlankLines bool `json:"collapseBlankLines"`
+}
+
+// Replacement 正则替换规则，replace 中可以使用 $1 引用分组
+type Replacement struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// DefaultClean 默认的正文清理规则：删除分页提示，合并连续的空行
+var DefaultClean = CleanConfig{
+	RemoveLines:        []string{"本章未完，点击下一页继续阅读"},
+	CollapseBlankLines: true,
+}
+
+// GetClean 返回网站的正文清理规则
+func (c *SiteConfig) GetClean() CleanConfig {
+	if c.Clean == nil {
+		return DefaultClean
+	}
+	return *c.Clean
+}
+
+// validate 检查清理规则中的正则表达式
+func (c *CleanConfig) validate() error {
+	patterns := append([]string{}, c.RemoveLinePatterns...)
+	for _, r := range c.Replacements {
+		patterns = append(patterns, r.Pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("正则表达式 %s 无效: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// RateLimitConfig 访问频率限制配置，同一网站的所有请求共享
+type RateLimitConfig struct {
+	// 每秒允许的请求数，0 表示不限制
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	// 令牌桶容量，允许的突发请求数
+	Burst int `json:"burst"`
+	// 每次请求前随机延时的范围（毫秒）
+	JitterMinMs int `json:"jitterMinMs"`
+	JitterMaxMs int `json:"jitterMaxMs"`
+	// 同时进行的最大请求数，0 表示不限制
+	MaxConcurrent int `json:"maxConcurrent"`
+}
+
+// DefaultRateLimit 默认的访问频率限制：每秒 1 个请求，并附加 0-500 毫秒的随机延时
+var DefaultRateLimit = RateLimitConfig{
+	RequestsPerSecond: 1,
+	Burst:             1,
+	JitterMinMs:       0,
+	JitterMaxMs:       500,
+}
+
+// GetRateLimit 返回网站的访问频率限制
+func (c *SiteConfig) GetRateLimit() RateLimitConfig {
+	if c.RateLimit == nil {
+		return DefaultRateLimit
+	}
+	return *c.RateLimit
 }
 
 // SitesConfig 网站配置集合
@@ -66,7 +174,7 @@ func init() {
 	}
 
 	if !loaded {
-		log.Fatal("未能找到或加载网站配置文件")
+		log.Println("未能找到或加载默认网站配置文件")
 	}
 }
 
@@ -84,6 +192,15 @@ func loadConfig(configPath string) error {
 		return err
 	}
 
+	for host, site := range config.Sites {
+		if site.Clean == nil {
+			continue
+		}
+		if err := site.Clean.validate(); err != nil {
+			return fmt.Errorf("网站 %s 的清理规则错误: %v", host, err)
+		}
+	}
+
 	// 更新全局配置
 	siteConfigs = config.Sites
 	return nil
@@ -99,6 +216,18 @@ func GetSiteConfig(url string) *SiteConfig {
 	return nil
 }
 
+// SiteConfigs 返回所有网站配置，按 Host 排序
+func SiteConfigs() []*SiteConfig {
+	configs := make([]*SiteConfig, 0, len(siteConfigs))
+	for _, config := range siteConfigs {
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Host < configs[j].Host
+	})
+	return configs
+}
+
 // ReloadConfig 重新加载配置文件
 func ReloadConfig(configPath string) error {
 	return loadConfig(configPath)
@@ -0,0 +1,267 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/scraper"
+	"chromedp-scraper/internal/utils"
+)
+
+// LoadNovelFromCategoryChapterLink 根据目录页，首先统计出来目录页的所有章节的链接，然后再
+// 抓取每个章节的内容，最后将结果保存到文件中，这样爬取章节内容的时候，可以并发爬取
+func LoadNovelFromCategoryChapterLink(ctx context.Context, catalogURL string, opts Options) error {
+	if catalogURL == "" {
+		return fmt.Errorf("请提供目录页的URL")
+	}
+	opts = opts.normalize()
+	ctx, opts = withWatermarks(ctx, opts)
+
+	// 打开小说的工作目录，同一本小说同时只能有一个任务
+	ws, err := utils.OpenWorkspaceForURL(catalogURL)
+	if err != nil {
+		return err
+	}
+	ctx, unlock, err := utils.LockWorkspace(ctx, ws)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	log.Printf("小说工作目录: %s\n", ws.Dir)
+	if err := utils.RecoverWorkspace(ws); err != nil {
+		return fmt.Errorf("修复工作目录失败: %v", err)
+	}
+
+	// 创建浏览器上下文
+	ctx, cancel, err := newBrowserContext(ctx, catalogURL, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	// 抓取目录
+	catalog, err := scraper.ScrapeCatalog(ctx, catalogURL)
+	if err != nil {
+		return fmt.Errorf("获取目录失败: %v", err)
+	}
+
+	for _, ch := range catalog.Chapters {
+		log.Printf("Index: %d, Title: %s", ch.Index, ch.Title)
+	}
+
+	// 保存元数据
+	meta := &models.NovelMeta{
+		Title:     catalog.Title,
+		Author:    catalog.Author,
+		SourceURL: catalogURL,
+	}
+	if err := ws.SaveMeta(meta); err != nil {
+		log.Printf("保存小说信息失败: %v\n", err)
+	}
+
+	// 将目录同步到章节清单，不在爬取范围内的章节标记为跳过
+	var added int
+	if err := utils.UpdateManifest(ws, func(m *models.Manifest) {
+		added = syncCatalog(m, catalog, opts)
+	}); err != nil {
+		return fmt.Errorf("更新章节清单失败: %v", err)
+	}
+	if added > 0 {
+		log.Printf("目录中有 %d 个新章节\n", added)
+	}
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		return fmt.Errorf("读取章节清单失败: %v", err)
+	}
+
+	// 只保留需要爬取的章节，已经保存过的章节不再爬取
+	var inRange, chapters []models.ChapterInfo
+	for _, ch := range catalog.Chapters {
+		if !opts.inRange(ch.Index) {
+			continue
+		}
+		inRange = append(inRange, ch)
+		if !utils.ChapterSaved(ws, manifest, ch.Index) {
+			chapters = append(chapters, ch)
+		}
+	}
+	if len(inRange) == 0 {
+		return fmt.Errorf("第 %d 章之后没有需要爬取的章节", opts.StartChapter)
+	}
+	if skipped := len(inRange) - len(chapters); skipped > 0 {
+		log.Printf("章节清单中已有 %d 个章节爬取完成，本次爬取剩余的 %d 个章节\n", skipped, len(chapters))
+	}
+
+	// 创建工作池
+	workerCount := opts.WorkerCount // 同时爬取的章节数
+	batchSize := opts.BatchSize     // 每批处理的章节数
+	totalChapters := len(chapters)
+	// 合并文件的第一个章节，之前爬取过更早的章节时以章节清单为准
+	firstIndex := inRange[0].Index
+	if first := manifest.FirstIndex(); first > 0 && first < firstIndex {
+		firstIndex = first
+	}
+
+	for i := 0; i < totalChapters; i += batchSize {
+		if stopping(ctx) {
+			log.Println("收到停止信号，不再爬取新的章节")
+			break
+		}
+
+		// 确定当前批次的结束索引
+		end := i + batchSize
+		if end > totalChapters {
+			end = totalChapters
+		}
+
+		// 当前批次的章节
+		currentBatch := chapters[i:end]
+		// 创建用于当前批次的通道
+		chapterChan := make(chan models.ChapterInfo, len(currentBatch))
+		resultChan := make(chan *models.Chapter, workerCount)
+		errorChan := make(chan error, workerCount)
+		doneChan := make(chan bool)
+
+		// 启动工作协程
+		for w := 0; w < workerCount; w++ {
+			go func() {
+				for chapter := range chapterChan {
+					// 收到停止信号后跳过还没有开始的章节
+					if stopping(ctx) {
+						continue
+					}
+					novel := &models.Novel{
+						Title: catalog.Title,
+					}
+
+					// 爬取章节内容
+					chapterContent, err := scraper.ScrapeChapter(ctx, chapter.URL, novel)
+					if err != nil {
+						utils.MarkChapterFailed(ws, chapter.Index, chapter.URL, err)
+						errorChan <- fmt.Errorf("章节 %d 爬取失败: %v", chapter.Index, err)
+						continue
+					}
+					// 下载章节中的图片，然后保存章节
+					downloadImages(ctx, ws, chapterContent, chapter.Index, chapter.URL, opts)
+					if err := utils.SaveChapter(ws, chapterContent, chapter.Index); err != nil {
+						utils.MarkChapterFailed(ws, chapter.Index, chapter.URL, err)
+						errorChan <- fmt.Errorf("章节 %d 保存失败: %v", chapter.Index, err)
+						continue
+					}
+					// 更新章节清单
+					if err := utils.MarkChapterDone(ws, chapter.Index, chapter.URL, chapterContent); err != nil {
+						errorChan <- fmt.Errorf("章节 %d 更新章节清单失败: %v", chapter.Index, err)
+					}
+					// 发送结果
+					resultChan <- chapterContent
+				}
+				doneChan <- true
+			}()
+		}
+
+		// 发送章节到工作池
+		go func() {
+			for _, chapter := range currentBatch {
+				chapterChan <- chapter
+			}
+			close(chapterChan)
+		}()
+
+		// 等待当前批次完成
+		finished := 0
+		for finished < workerCount {
+			select {
+			case err := <-errorChan:
+				log.Println("错误:", err)
+			case <-resultChan:
+			case <-doneChan:
+				finished++
+			}
+		}
+
+		// 每完成一批就按章节序号合并一次文件
+		if _, err := utils.MergeChapterFiles(ws, 1, catalog.Title, firstIndex); err != nil {
+			log.Printf("合并文件失败: %v\n", err)
+		}
+	}
+
+	// 最终合并所有文件
+	result, err := utils.MergeChapterFiles(ws, 1, catalog.Title, firstIndex)
+	if err != nil {
+		log.Printf("最终合并文件失败: %v\n", err)
+	} else {
+		reportMissingChapters(ws, inRange, result)
+	}
+
+	// 目录中所有章节都已完成时标记为完成
+	if err := utils.UpdateManifest(ws, func(m *models.Manifest) {
+		m.IsCompleted = m.Count(models.ChapterDone) >= len(catalog.Chapters)
+	}); err != nil {
+		log.Printf("更新章节清单失败: %v\n", err)
+	}
+
+	log.Printf("爬取完成，共处理 %d 章节\n", totalChapters)
+
+	if opts.EPUB {
+		return ExportEPUB(ws, opts.CoverPath)
+	}
+	return nil
+}
+
+// syncCatalog 将目录中的章节同步到章节清单，返回章节清单中原来没有的章节数
+func syncCatalog(manifest *models.Manifest, catalog *models.Catalog, opts Options) int {
+	manifest.Title = catalog.Title
+	manifest.Mode = models.ModeCatalog
+	manifest.IsCompleted = false
+
+	added := 0
+	for _, ch := range catalog.Chapters {
+		if manifest.Chapter(ch.Index) == nil {
+			added++
+		}
+		record := manifest.Record(ch.Index)
+		if record.Title == "" {
+			record.Title = ch.Title
+		}
+		record.URL = ch.URL
+		switch {
+		case record.Status == models.ChapterDone:
+		case !opts.inRange(ch.Index):
+			record.Status = models.ChapterSkipped
+		case record.Status == models.ChapterSkipped:
+			record.Status = models.ChapterPending
+		}
+	}
+	return added
+}
+
+// reportMissingChapters 输出已合并章节之后还没有保存的章节
+func reportMissingChapters(ws *utils.Workspace, chapters []models.ChapterInfo, result *utils.MergeResult) {
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		log.Printf("读取章节清单失败: %v\n", err)
+		return
+	}
+
+	var missing []string
+	for _, ch := range chapters {
+		if ch.Index <= result.MergedUpTo {
+			continue
+		}
+		if _, err := os.Stat(ws.ChapterPath(ch.Index)); err != nil {
+			line := fmt.Sprintf("%d %s", ch.Index, ch.Title)
+			if record := manifest.Chapter(ch.Index); record != nil && record.LastError != "" {
+				line += fmt.Sprintf("（尝试 %d 次: %s）", record.Attempts, record.LastError)
+			}
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) > 0 {
+		log.Printf("已合并到第 %d 章，以下 %d 个章节缺失，之后的章节暂未合并:\n  %s\n",
+			result.MergedUpTo, len(missing), strings.Join(missing, "\n  "))
+	}
+}
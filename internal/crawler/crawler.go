@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/fetcher"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/scraper"
+	"chromedp-scraper/internal/utils"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Options 爬取参数
+type Options struct {
+	// 同时爬取的章节数
+	WorkerCount int
+	// 每批处理的章节数
+	BatchSize int
+	// 起始章节序号（从1开始）
+	StartChapter int
+	// 结束章节序号，0 表示不限制
+	EndChapter int
+	// 每个浏览器 tab 最多导航的次数，超过后重新创建
+	TabMaxUses int
+	// 爬取完成后是否导出 EPUB
+	EPUB bool
+	// EPUB 封面图片路径
+	CoverPath string
+	// 不下载章节中的图片
+	NoImages bool
+	// 抓取章节时删除的水印规则，为 nil 时在开始爬取前从水印规则文件加载
+	Watermarks *models.Watermarks
+}
+
+// DefaultOptions 返回默认的爬取参数
+func DefaultOptions() Options {
+	return Options{
+		WorkerCount:  1,
+		BatchSize:    10,
+		StartChapter: 1,
+		TabMaxUses:   fetcher.DefaultTabMaxUses,
+	}
+}
+
+// normalize 修正不合法的参数
+func (o Options) normalize() Options {
+	if o.WorkerCount < 1 {
+		o.WorkerCount = 1
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = 1
+	}
+	if o.StartChapter < 1 {
+		o.StartChapter = 1
+	}
+	return o
+}
+
+// withWatermarks 开始爬取前加载一次水印规则并附加到上下文中，之后抓取的章节都使用这份规则，
+// opts.Watermarks 已经设置时直接使用
+func withWatermarks(ctx context.Context, opts Options) (context.Context, Options) {
+	if opts.Watermarks == nil {
+		watermarks, err := utils.LoadWatermarks()
+		if err != nil {
+			log.Printf("读取水印规则失败: %v\n", err)
+			watermarks = &models.Watermarks{}
+		}
+		opts.Watermarks = watermarks
+	}
+	return scraper.WithWatermarks(ctx, opts.Watermarks), opts
+}
+
+// inRange 判断章节序号是否在需要爬取的范围内
+func (o Options) inRange(num int) bool {
+	if num < o.StartChapter {
+		return false
+	}
+	return o.EndChapter <= 0 || num <= o.EndChapter
+}
+
+// newBrowserContext 启动浏览器并返回带有 tab 池的浏览器上下文，tab 数量与 WorkerCount 一致。
+// 如果网站配置使用 http 抓取或者正在回放记录的页面，则不需要启动浏览器
+func newBrowserContext(ctx context.Context, u string, opts Options) (context.Context, context.CancelFunc, error) {
+	if fetcher.Replaying() {
+		return ctx, func() {}, nil
+	}
+	if siteConfig := config.GetSiteConfig(u); siteConfig != nil && siteConfig.Fetcher == fetcher.KindHTTP {
+		return ctx, func() {}, nil
+	}
+
+	// 设置 Chrome 选项
+	chromeOpts := utils.GetChromeOptions()
+	// 检查本地是否有 Chrome，如果没有则下载到项目目录
+	if !utils.CheckChromeInstalled() {
+		log.Println("Chrome not found, downloading...")
+		if err := utils.DownloadChrome(); err != nil {
+			return nil, nil, fmt.Errorf("请先安装 Chrome 浏览器: %v", err)
+		}
+		// 添加自定义 Chrome 路径
+		chromeOpts = append(chromeOpts, chromedp.ExecPath(filepath.Join(".", "chrome-linux", "chrome")))
+	}
+
+	// 创建浏览器实例
+	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, chromeOpts...)
+
+	// 创建浏览器上下文
+	browserCtx, browserCancel := chromedp.NewContext(
+		allocCtx,
+		chromedp.WithLogf(log.Printf), // 添加日志记录
+	)
+
+	// 启动浏览器，之后的 tab 都在这个浏览器中创建
+	if err := chromedp.Run(browserCtx); err != nil {
+		browserCancel()
+		allocCancel()
+		return nil, nil, fmt.Errorf("启动浏览器失败: %v", err)
+	}
+
+	// 创建 tab 池，每个工作协程使用一个 tab
+	pool := fetcher.NewTabPool(browserCtx, opts.WorkerCount, opts.TabMaxUses)
+	return fetcher.WithTabPool(browserCtx, pool), func() {
+		pool.Close()
+		browserCancel()
+		allocCancel()
+	}, nil
+}
@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// DaemonOptions 后台模式的参数
+type DaemonOptions struct {
+	// 同时更新的小说数
+	Parallel int
+	// 默认的检查间隔，书库中的小说可以单独设置
+	Interval time.Duration
+	// 连续没有新章节时，检查间隔最多延长到的时间
+	MaxInterval time.Duration
+	// 检查间隔的随机抖动比例，例如 0.1 表示上下浮动 10%
+	Jitter float64
+	// 重新读取书库的间隔，书库中新加入的小说最迟在这个时间之后开始检查
+	PollInterval time.Duration
+}
+
+// DefaultDaemonOptions 返回默认的后台模式参数
+func DefaultDaemonOptions() DaemonOptions {
+	return DaemonOptions{
+		Parallel:     2,
+		Interval:     6 * time.Hour,
+		MaxInterval:  72 * time.Hour,
+		Jitter:       0.1,
+		PollInterval: time.Minute,
+	}
+}
+
+// RunDaemon 持续运行，按照每本小说的检查间隔更新书库中的小说。
+// 收到停止信号后不再开始新的检查，等待正在爬取的章节完成后返回
+func RunDaemon(ctx context.Context, dopts DaemonOptions, opts Options) error {
+	if dopts.Parallel < 1 {
+		dopts.Parallel = 1
+	}
+	if dopts.PollInterval <= 0 {
+		dopts.PollInterval = time.Minute
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		running = make(map[string]bool)
+		sem     = make(chan struct{}, dopts.Parallel)
+		// 有小说更新完成时唤醒调度循环
+		wake = make(chan struct{}, 1)
+	)
+	defer wg.Wait()
+
+	log.Printf("后台模式已启动，同时更新 %d 本小说，默认检查间隔 %v\n", dopts.Parallel, dopts.Interval)
+	for {
+		library, err := utils.LoadLibrary()
+		if err != nil {
+			log.Printf("读取书库失败: %v\n", err)
+			library = &models.Library{}
+		}
+
+		// 每一轮重新读取水印规则，这一轮开始更新的小说使用同一份规则
+		_, roundOpts := withWatermarks(ctx, opts)
+
+		now := time.Now().Unix()
+		for _, entry := range library.Novels {
+			mu.Lock()
+			busy := running[entry.ID]
+			mu.Unlock()
+			if busy || entry.NextCheckTime > now || stopping(ctx) {
+				continue
+			}
+			// 同时更新的小说数已满，等待下一轮调度
+			select {
+			case sem <- struct{}{}:
+			default:
+				continue
+			}
+
+			mu.Lock()
+			running[entry.ID] = true
+			mu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result := updateLibraryEntry(ctx, entry, roundOpts)
+				scheduleNext(ctx, entry.ID, result, dopts)
+
+				mu.Lock()
+				delete(running, entry.ID)
+				mu.Unlock()
+				<-sem
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}()
+		}
+
+		timer := time.NewTimer(dopts.PollInterval)
+		select {
+		case <-Stopped(ctx):
+			timer.Stop()
+			log.Println("收到停止信号，等待正在更新的小说完成")
+			return nil
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// scheduleNext 记录小说下一次检查的时间：有新章节时使用检查间隔，
+// 连续没有新章节或者出错时检查间隔逐次加倍，最多到 MaxInterval，并加入随机抖动
+func scheduleNext(ctx context.Context, id string, result LibraryResult, dopts DaemonOptions) {
+	err := utils.UpdateLibrary(func(library *models.Library) error {
+		entry := library.Find(id)
+		if entry == nil {
+			return nil
+		}
+
+		now := time.Now()
+		switch {
+		case stopping(ctx):
+			// 更新被中断，下次启动时立即继续
+			entry.NextCheckTime = now.Unix()
+			return nil
+		case errors.Is(result.Err, utils.ErrWorkspaceLocked):
+			// 其他任务正在使用工作目录，稍后重试
+			entry.NextCheckTime = now.Add(dopts.PollInterval).Unix()
+			return nil
+		case result.Err == nil && result.NewChapters > 0:
+			entry.IdleChecks = 0
+		default:
+			entry.IdleChecks++
+		}
+
+		interval := dopts.Interval
+		if entry.CheckInterval != "" {
+			if d, err := time.ParseDuration(entry.CheckInterval); err == nil && d > 0 {
+				interval = d
+			}
+		}
+		interval = jitter(backoff(interval, entry.IdleChecks, dopts.MaxInterval), dopts.Jitter)
+		entry.NextCheckTime = now.Add(interval).Unix()
+		log.Printf("小说 %s 新增 %d 章，下一次检查时间 %s\n",
+			id, result.NewChapters, now.Add(interval).Format("2006-01-02 15:04"))
+		return nil
+	})
+	if err != nil {
+		log.Printf("更新书库失败: %v\n", err)
+	}
+}
+
+// backoff 连续 idle 次没有新章节时，将检查间隔加倍 idle 次，最多到 maxInterval，
+// 检查间隔本身比 maxInterval 长时不再延长
+func backoff(interval time.Duration, idle int, maxInterval time.Duration) time.Duration {
+	limit := max(maxInterval, interval)
+	for i := 0; i < idle && interval < limit; i++ {
+		interval *= 2
+	}
+	return min(interval, limit)
+}
+
+// jitter 让检查间隔随机浮动 ratio 的比例，避免所有小说同时检查
+func jitter(interval time.Duration, ratio float64) time.Duration {
+	if ratio <= 0 {
+		return interval
+	}
+	return interval + time.Duration(float64(interval)*ratio*(2*rand.Float64()-1))
+}
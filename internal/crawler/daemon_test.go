@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		idle        int
+		maxInterval time.Duration
+		want        time.Duration
+	}{
+		{"有新章节时使用检查间隔", 6 * time.Hour, 0, 72 * time.Hour, 6 * time.Hour},
+		{"连续一次没有新章节", 6 * time.Hour, 1, 72 * time.Hour, 12 * time.Hour},
+		{"连续三次没有新章节", 6 * time.Hour, 3, 72 * time.Hour, 48 * time.Hour},
+		{"最多延长到最大间隔", 6 * time.Hour, 4, 72 * time.Hour, 72 * time.Hour},
+		{"次数很多时不会溢出", 6 * time.Hour, 1000, 72 * time.Hour, 72 * time.Hour},
+		{"检查间隔比最大间隔长时不再延长", 96 * time.Hour, 2, 72 * time.Hour, 96 * time.Hour},
+		{"没有设置最大间隔", 6 * time.Hour, 3, 0, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoff(tt.interval, tt.idle, tt.maxInterval); got != tt.want {
+				t.Errorf("backoff(%v, %d, %v) = %v，期望 %v", tt.interval, tt.idle, tt.maxInterval, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		ratio    float64
+		min, max time.Duration
+	}{
+		{"没有抖动", 6 * time.Hour, 0, 6 * time.Hour, 6 * time.Hour},
+		{"负数的比例不抖动", 6 * time.Hour, -0.5, 6 * time.Hour, 6 * time.Hour},
+		{"上下浮动 10%", 10 * time.Hour, 0.1, 9 * time.Hour, 11 * time.Hour},
+		{"上下浮动 50%", time.Hour, 0.5, 30 * time.Minute, 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := jitter(tt.interval, tt.ratio); got < tt.min || got > tt.max {
+					t.Fatalf("jitter(%v, %v) = %v，超出了 [%v, %v]", tt.interval, tt.ratio, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
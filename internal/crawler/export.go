@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"chromedp-scraper/internal/export"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// ExportEPUB 读取工作目录中小说的合并文件，并根据元数据导出为 EPUB
+func ExportEPUB(ws *utils.Workspace, coverPath string) error {
+	novel, err := loadExportNovel(ws)
+	if err != nil {
+		return err
+	}
+
+	path := ws.EPUBFilePath(novel.Title)
+	if err := export.WriteEPUB(path, novel, export.EPUBOptions{CoverPath: coverPath, ImageDir: ws.ImagesDir()}); err != nil {
+		return fmt.Errorf("导出 EPUB 失败: %v", err)
+	}
+	log.Printf("成功导出 EPUB: %s，共 %d 章\n", path, len(novel.Chapters))
+	return nil
+}
+
+// ExportHTML 读取工作目录中小说的合并文件，导出为单个 HTML 文件
+func ExportHTML(ws *utils.Workspace) error {
+	novel, err := loadExportNovel(ws)
+	if err != nil {
+		return err
+	}
+
+	path := ws.HTMLFilePath(novel.Title)
+	if err := export.WriteHTML(path, novel, ws.ImagesDir()); err != nil {
+		return fmt.Errorf("导出 HTML 失败: %v", err)
+	}
+	log.Printf("成功导出 HTML: %s，共 %d 章\n", path, len(novel.Chapters))
+	return nil
+}
+
+// ExportMarkdown 读取工作目录中小说的合并文件，导出为单个 Markdown 文件
+func ExportMarkdown(ws *utils.Workspace) error {
+	novel, err := loadExportNovel(ws)
+	if err != nil {
+		return err
+	}
+
+	path := ws.MarkdownFilePath(novel.Title)
+	if err := export.WriteMarkdown(path, novel, ws.ImagesDir()); err != nil {
+		return fmt.Errorf("导出 Markdown 失败: %v", err)
+	}
+	log.Printf("成功导出 Markdown: %s，共 %d 章\n", path, len(novel.Chapters))
+	return nil
+}
+
+// exportOutdated 导出的文件不存在或者比合并文件旧时返回 true，例如上次导出后更新被中断
+func exportOutdated(ws *utils.Workspace, path, title string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	merged, err := os.Stat(ws.MergedFilePath(title))
+	return err == nil && info.ModTime().Before(merged.ModTime())
+}
+
+// reexportDocuments 章节变化后重新导出之前导出过的 HTML 和 Markdown 文件，EPUB 由调用者处理
+func reexportDocuments(ws *utils.Workspace, title string) error {
+	if _, err := os.Stat(ws.HTMLFilePath(title)); err == nil {
+		if err := ExportHTML(ws); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(ws.MarkdownFilePath(title)); err == nil {
+		if err := ExportMarkdown(ws); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadExportNovel 读取合并文件中的章节和内容块，以及元数据中的作者和来源
+func loadExportNovel(ws *utils.Workspace) (*models.Novel, error) {
+	meta, err := ws.LoadMeta()
+	if err != nil {
+		return nil, fmt.Errorf("读取小说信息失败: %v", err)
+	}
+	if meta == nil || meta.Title == "" {
+		return nil, fmt.Errorf("工作目录 %s 中没有小说信息", ws.Dir)
+	}
+
+	novel, err := utils.LoadMergedNovel(ws, meta.Title)
+	if err != nil {
+		return nil, err
+	}
+	novel.Author = meta.Author
+	novel.SourceURL = meta.SourceURL
+	return novel, nil
+}
@@ -0,0 +1,285 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"chromedp-scraper/internal/fetcher"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/scraper"
+	"chromedp-scraper/internal/utils"
+)
+
+// LoadNovelFromFirstChapterLink 根据起始章节的链接，抓取该章节的内容
+func LoadNovelFromFirstChapterLink(ctx context.Context, firstChapterURL string, opts Options) error {
+	if firstChapterURL == "" {
+		return fmt.Errorf("请提供起始章节的URL")
+	}
+	opts = opts.normalize()
+	ctx, opts = withWatermarks(ctx, opts)
+
+	// 打开小说的工作目录
+	ws, err := utils.OpenWorkspaceForURL(firstChapterURL)
+	if err != nil {
+		return err
+	}
+	ctx, unlock, err := utils.LockWorkspace(ctx, ws)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	log.Printf("小说工作目录: %s\n", ws.Dir)
+	if err := utils.RecoverWorkspace(ws); err != nil {
+		return fmt.Errorf("修复工作目录失败: %v", err)
+	}
+
+	// 检查是否已经爬取过这本小说
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		return fmt.Errorf("读取章节清单失败: %v", err)
+	}
+	if manifest.IsCompleted {
+		log.Printf("检测到小说《%s》已经爬取完成\n", manifest.Title)
+		log.Println("已有完整内容，退出程序")
+		return nil
+	}
+
+	currentURL, chapterNum := firstChapterURL, opts.StartChapter
+	if url, index, ok := followResumePoint(manifest); ok {
+		log.Printf("检测到小说《%s》有未完成的爬取进度\n", manifest.Title)
+		log.Printf("将从上次爬取的位置继续: 第 %d 章 %s\n", index, url)
+		currentURL, chapterNum = url, index
+	}
+
+	novel := loadNovel(ws, firstChapterURL)
+	if err := ws.SaveMeta(novelMeta(novel)); err != nil {
+		log.Printf("保存小说信息失败: %v\n", err)
+	}
+
+	// 创建浏览器上下文
+	ctx, cancel, err := newBrowserContext(ctx, currentURL, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if err := followChapters(ctx, ws, novel, currentURL, chapterNum, opts); err != nil {
+		return err
+	}
+	if opts.EPUB {
+		return ExportEPUB(ws, opts.CoverPath)
+	}
+	return nil
+}
+
+// ResumeNovel 根据工作目录中的章节清单，只爬取缺失或失败的章节，
+// 目录模式的小说重新读取目录，顺序模式的小说从上次中断的位置继续，
+// key 为小说标识或标题
+func ResumeNovel(ctx context.Context, key string, opts Options) error {
+	opts = opts.normalize()
+	ctx, opts = withWatermarks(ctx, opts)
+
+	ws, err := utils.FindWorkspace(key)
+	if err != nil {
+		return err
+	}
+	ctx, unlock, err := utils.LockWorkspace(ctx, ws)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := utils.RecoverWorkspace(ws); err != nil {
+		return fmt.Errorf("修复工作目录失败: %v", err)
+	}
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		return fmt.Errorf("读取章节清单失败: %v", err)
+	}
+	if len(manifest.Chapters) == 0 {
+		return fmt.Errorf("未找到小说《%s》的爬取进度", key)
+	}
+	if manifest.IsCompleted {
+		log.Printf("检测到小说《%s》已经爬取完成\n", manifest.Title)
+		return nil
+	}
+
+	if manifest.Mode == models.ModeCatalog {
+		meta, err := ws.LoadMeta()
+		if err != nil || meta == nil || meta.SourceURL == "" {
+			return fmt.Errorf("读取小说《%s》的目录页失败: %v", key, err)
+		}
+		log.Printf("根据目录页继续爬取缺失的章节: %s\n", meta.SourceURL)
+		return LoadNovelFromCategoryChapterLink(ctx, meta.SourceURL, opts)
+	}
+
+	currentURL, chapterNum, ok := followResumePoint(manifest)
+	if !ok {
+		return fmt.Errorf("小说《%s》没有可以继续的章节链接", key)
+	}
+	novel := loadNovel(ws, currentURL)
+	if novel.Title == "未命名" && manifest.Title != "" {
+		novel.Title = manifest.Title
+	}
+
+	// 创建浏览器上下文
+	ctx, cancel, err := newBrowserContext(ctx, currentURL, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	log.Printf("将从上次爬取的位置继续: 第 %d 章 %s\n", chapterNum, currentURL)
+	if err := followChapters(ctx, ws, novel, currentURL, chapterNum, opts); err != nil {
+		return err
+	}
+	if opts.EPUB {
+		return ExportEPUB(ws, opts.CoverPath)
+	}
+	return nil
+}
+
+// followResumePoint 根据章节清单确定顺序爬取继续的位置，
+// 优先重新爬取序号最小的失败章节，否则从最后完成章节的下一章继续
+func followResumePoint(manifest *models.Manifest) (string, int, bool) {
+	for _, record := range manifest.Chapters {
+		if record.Status != models.ChapterDone && record.URL != "" {
+			return record.URL, record.Index, true
+		}
+	}
+	if last := manifest.LastDone(); last != nil && last.NextURL != "" {
+		return last.NextURL, last.Index + 1, true
+	}
+	return "", 0, false
+}
+
+// followChapters 从当前章节开始，沿着下一章链接依次爬取并保存，
+// 清单中已经保存过的章节沿用记录的下一章链接，不再重新爬取
+func followChapters(ctx context.Context, ws *utils.Workspace, novel *models.Novel,
+	currentURL string, chapterNum int, opts Options) error {
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		return fmt.Errorf("读取章节清单失败: %v", err)
+	}
+	// 合并文件的第一个章节，继续爬取时以章节清单为准，之前保存的章节可能还没有合并
+	firstIndex := chapterNum
+	if first := manifest.FirstIndex(); first > 0 && first < firstIndex {
+		firstIndex = first
+	}
+	if err := utils.UpdateManifest(ws, func(m *models.Manifest) {
+		m.Mode = models.ModeFollow
+	}); err != nil {
+		log.Printf("更新章节清单失败: %v\n", err)
+	}
+
+	// 循环的向后迭代
+	for currentURL != "" {
+		if stopping(ctx) {
+			log.Println("收到停止信号，不再爬取新的章节")
+			break
+		}
+		// 到达结束章节后停止
+		if opts.EndChapter > 0 && chapterNum > opts.EndChapter {
+			log.Printf("已到达结束章节 %d\n", opts.EndChapter)
+			break
+		}
+
+		// 跳过已经保存过的章节
+		if record := manifest.Chapter(chapterNum); record != nil && record.URL == currentURL &&
+			record.NextURL != "" && utils.ChapterSaved(ws, manifest, chapterNum) {
+			currentURL = record.NextURL
+			chapterNum++
+			continue
+		}
+
+		// 清单中已有的章节需要重新爬取时，说明上次爬取时还没有下一章链接，不能使用缓存的页面
+		scrapeCtx := ctx
+		if record := manifest.Chapter(chapterNum); record != nil && record.URL == currentURL {
+			scrapeCtx = fetcher.WithRevalidate(ctx, fetcher.PageChapter)
+		}
+
+		// 添加重试机制
+		chapter, err := scraper.RetryScrapeChapter(scrapeCtx, currentURL, nil, novel)
+		if err != nil {
+			log.Printf("达到最大重试次数，放弃当前章节: %v\n", err)
+			utils.MarkChapterFailed(ws, chapterNum, currentURL, err)
+			break
+		}
+		if len(novel.Chapters) == 0 {
+			// 第一个章节爬取后才能拿到小说的标题和作者
+			if err := ws.SaveMeta(novelMeta(novel)); err != nil {
+				log.Printf("保存小说信息失败: %v\n", err)
+			}
+		}
+		novel.Chapters = append(novel.Chapters, chapter)
+
+		// 下载章节中的图片，然后保存章节内容
+		downloadImages(ctx, ws, chapter, chapterNum, currentURL, opts)
+		if err := utils.SaveChapter(ws, chapter, chapterNum); err != nil {
+			log.Printf("保存章节失败: %v\n", err)
+			utils.MarkChapterFailed(ws, chapterNum, currentURL, err)
+			break
+		}
+		// 更新章节清单
+		if err := utils.MarkChapterDone(ws, chapterNum, currentURL, chapter); err != nil {
+			log.Printf("更新章节清单失败: %v\n", err)
+		}
+
+		// 每爬取一批就合并一次文件
+		if _, err := utils.MergeChapterFiles(ws, opts.BatchSize, novel.Title, firstIndex); err != nil {
+			log.Printf("合并文件失败: %v\n", err)
+		}
+
+		// 更新URL到下一章
+		currentURL = chapter.NextLink
+		chapterNum++
+	}
+
+	// 合并所有剩余的章节文件
+	if _, err := utils.MergeChapterFiles(ws, 1, novel.Title, firstIndex); err != nil {
+		log.Printf("最终合并文件失败: %v\n", err)
+	}
+
+	// 没有下一章说明已经爬取到最后一章
+	if currentURL == "" {
+		if err := utils.UpdateManifest(ws, func(m *models.Manifest) {
+			m.IsCompleted = true
+		}); err != nil {
+			log.Printf("更新章节清单失败: %v\n", err)
+		}
+	}
+
+	log.Printf("爬取完成，共爬取 %d 章节\n", len(novel.Chapters))
+	return nil
+}
+
+// loadNovel 根据工作目录中的元数据创建小说
+func loadNovel(ws *utils.Workspace, sourceURL string) *models.Novel {
+	novel := &models.Novel{
+		Title:     "未命名",
+		Author:    "未知",
+		SourceURL: sourceURL,
+		Chapters:  []*models.Chapter{},
+	}
+	if meta, err := ws.LoadMeta(); err == nil && meta != nil {
+		if meta.Title != "" {
+			novel.Title = meta.Title
+		}
+		if meta.Author != "" {
+			novel.Author = meta.Author
+		}
+		if meta.SourceURL != "" {
+			novel.SourceURL = meta.SourceURL
+		}
+	}
+	return novel
+}
+
+// novelMeta 根据爬取到的小说信息生成元数据
+func novelMeta(novel *models.Novel) *models.NovelMeta {
+	return &models.NovelMeta{
+		Title:     novel.Title,
+		Author:    novel.Author,
+		SourceURL: novel.SourceURL,
+	}
+}
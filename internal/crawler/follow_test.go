@@ -0,0 +1,162 @@
+package crawler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// testChapterCount 测试网站的章节数
+const testChapterCount = 6
+
+// testSiteConfig 测试网站的配置，使用 http 抓取方式，不需要浏览器
+const testSiteConfig = `{"sites":{"127.0.0.1":{
+	"host": "127.0.0.1",
+	"fetcher": "http",
+	"rateLimit": {},
+	"novelTitleSelectors": ["h2"],
+	"chapterTitleSelectors": ["h1"],
+	"contentSelectors": ["#content"],
+	"nextChapterKeywords": ["下一章"]
+}}}`
+
+// startTestSite 启动顺序爬取使用的测试网站，章节页面为 /book/1/<序号>.html，
+// 最后一章没有下一章链接
+func startTestSite(t *testing.T) string {
+	t.Helper()
+	utils.SetWorkspaceRoot(t.TempDir())
+	t.Cleanup(func() { utils.SetWorkspaceRoot("") })
+
+	configPath := filepath.Join(t.TempDir(), "sites.json")
+	if err := os.WriteFile(configPath, []byte(testSiteConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReloadConfig(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var index int
+		if _, err := fmt.Sscanf(r.URL.Path, "/book/1/%d.html", &index); err != nil || index < 1 || index > testChapterCount {
+			http.NotFound(w, r)
+			return
+		}
+		next := ""
+		if index < testChapterCount {
+			next = fmt.Sprintf(`<a href="/book/1/%d.html">下一章</a>`, index+1)
+		}
+		fmt.Fprintf(w, `<html><body><h2>测试小说</h2><h1>标题%d</h1><div id="content"><p>第 %d 章的正文</p></div>%s</body></html>`,
+			index, index, next)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// mergedChapterIndexes 返回合并文件中按顺序出现的章节序号
+func mergedChapterIndexes(t *testing.T, ws *utils.Workspace, title string) []int {
+	t.Helper()
+	data, err := os.ReadFile(ws.MergedFilePath(title))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []int
+	for _, m := range regexp.MustCompile(`(?m)^第(\d+)章 `).FindAllStringSubmatch(string(data), -1) {
+		var index int
+		fmt.Sscanf(m[1], "%d", &index)
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// TestResumeMergesEarlierChapters 爬取中断时已经保存但还没有合并的章节，继续爬取后应该合并到文件中
+func TestResumeMergesEarlierChapters(t *testing.T) {
+	tests := []struct {
+		name string
+		// 中断前保存的章节
+		saved int
+		// 中断时爬取失败的章节，0 表示没有
+		failed int
+	}{
+		{"从下一章继续", 3, 0},
+		{"从失败的章节继续", 3, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := startTestSite(t)
+			chapterURL := func(index int) string { return fmt.Sprintf("%s/book/1/%d.html", site, index) }
+
+			// 模拟爬取到一半时程序被终止：章节已经保存，但还没有达到合并的批次大小
+			ws, err := utils.OpenWorkspaceForURL(chapterURL(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ws.SaveMeta(&models.NovelMeta{Title: "测试小说", SourceURL: chapterURL(1)}); err != nil {
+				t.Fatal(err)
+			}
+			for index := 1; index <= tt.saved; index++ {
+				chapter := &models.Chapter{
+					Title:    fmt.Sprintf("标题%d", index),
+					Content:  fmt.Sprintf("第 %d 章的正文", index),
+					NextLink: chapterURL(index + 1),
+				}
+				if err := utils.SaveChapter(ws, chapter, index); err != nil {
+					t.Fatal(err)
+				}
+				if err := utils.MarkChapterDone(ws, index, chapterURL(index), chapter); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.failed > 0 {
+				if err := utils.MarkChapterFailed(ws, tt.failed, chapterURL(tt.failed), fmt.Errorf("连接超时")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := DefaultOptions()
+			opts.BatchSize = 10
+			if err := ResumeNovel(context.Background(), ws.ID, opts); err != nil {
+				t.Fatalf("继续爬取失败: %v", err)
+			}
+
+			got := mergedChapterIndexes(t, ws, "测试小说")
+			want := make([]int, testChapterCount)
+			for i := range want {
+				want[i] = i + 1
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("合并文件中的章节为 %v，期望 %v", got, want)
+			}
+			if files, _ := filepath.Glob(filepath.Join(ws.Dir, "chapters", "*.txt")); len(files) > 0 {
+				t.Errorf("合并后还有章节文件: %s", strings.Join(files, ", "))
+			}
+			manifest, err := utils.LoadManifest(ws)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.MergedChapterNum != testChapterCount {
+				t.Errorf("章节清单中已合并到第 %d 章，期望第 %d 章", manifest.MergedChapterNum, testChapterCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"context"
+	"log"
+
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/scraper"
+	"chromedp-scraper/internal/utils"
+)
+
+// downloadImages 下载章节中的图片并保存到工作目录，图片内容块记录保存的文件名。
+// 之前已经下载过的图片直接使用；下载失败的图片只记录日志，导出时引用原来的链接
+func downloadImages(ctx context.Context, ws *utils.Workspace, chapter *models.Chapter, num int, chapterURL string, opts Options) {
+	if opts.NoImages {
+		return
+	}
+	var saved map[string]string
+	for i := range chapter.Blocks {
+		block := &chapter.Blocks[i]
+		if block.Type != models.BlockImage || block.Src == "" || stopping(ctx) {
+			continue
+		}
+		if saved == nil {
+			saved = utils.SavedImages(ws, num)
+		}
+		if file, ok := saved[block.Src]; ok {
+			block.File = file
+			continue
+		}
+
+		data, ext, err := scraper.FetchImage(ctx, block.Src, chapterURL)
+		if err != nil {
+			log.Printf("第 %d 章的图片 %s 下载失败: %v\n", num, block.Src, err)
+			continue
+		}
+		if block.File, err = utils.SaveImage(ws, data, ext); err != nil {
+			log.Printf("保存第 %d 章的图片 %s 失败: %v\n", num, block.Src, err)
+			continue
+		}
+		saved[block.Src] = block.File
+		log.Printf("已下载第 %d 章的图片: %s\n", num, block.File)
+	}
+}
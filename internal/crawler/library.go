@@ -0,0 +1,197 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// LibraryResult 书库中一本小说的更新结果
+type LibraryResult struct {
+	Entry *models.LibraryEntry
+	// 新下载的章节数
+	NewChapters int
+	// 已经爬取的章节数
+	TotalChapters int
+	Err           error
+}
+
+// AddToLibrary 将小说加入书库，entry 需要设置链接、爬取模式和导出格式，
+// 爬取模式为 catalog 时链接是目录页，为 follow 时是起始章节
+func AddToLibrary(entry *models.LibraryEntry) error {
+	if entry.Mode != models.ModeCatalog && entry.Mode != models.ModeFollow {
+		return fmt.Errorf("不支持的爬取模式: %s", entry.Mode)
+	}
+	for _, format := range entry.Formats {
+		switch format {
+		case models.FormatTXT, models.FormatEPUB, models.FormatHTML, models.FormatMarkdown:
+		default:
+			return fmt.Errorf("不支持的导出格式: %s", format)
+		}
+	}
+	if entry.CheckInterval != "" {
+		if _, err := time.ParseDuration(entry.CheckInterval); err != nil {
+			return fmt.Errorf("检查间隔 %s 无效: %v", entry.CheckInterval, err)
+		}
+	}
+	if config.GetSiteConfig(entry.URL) == nil {
+		return fmt.Errorf("没有找到网站 %s 的配置", entry.URL)
+	}
+
+	entry.ID = utils.GetNovelIdentifier(entry.URL)
+	entry.AddedTime = time.Now().Unix()
+	// 已经爬取过的小说，沿用工作目录中的信息
+	if ws, err := utils.FindWorkspace(entry.ID); err == nil {
+		if meta, err := ws.LoadMeta(); err == nil && meta != nil {
+			entry.Title = meta.Title
+		}
+		if manifest, err := utils.LoadManifest(ws); err == nil {
+			entry.LastChapterCount = manifest.Count(models.ChapterDone)
+		}
+	}
+
+	return utils.UpdateLibrary(func(library *models.Library) error {
+		if existing := library.Find(entry.ID); existing != nil {
+			return fmt.Errorf("小说 %s 已经在书库中", entry.ID)
+		}
+		library.Novels = append(library.Novels, entry)
+		return nil
+	})
+}
+
+// RemoveFromLibrary 从书库中移除小说，key 为小说标识、标题或链接，工作目录中的文件保留
+func RemoveFromLibrary(key string) (*models.LibraryEntry, error) {
+	var removed *models.LibraryEntry
+	err := utils.UpdateLibrary(func(library *models.Library) error {
+		if removed = library.Remove(key); removed == nil {
+			return fmt.Errorf("书库中没有小说 %s", key)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// UpdateLibrary 检查书库中所有小说的新章节，最多同时更新 parallel 本小说，
+// 返回每本小说的更新结果
+func UpdateLibrary(ctx context.Context, parallel int, opts Options) ([]LibraryResult, error) {
+	library, err := utils.LoadLibrary()
+	if err != nil {
+		return nil, fmt.Errorf("读取书库失败: %v", err)
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	// 所有小说使用同一份水印规则
+	_, opts = withWatermarks(ctx, opts)
+
+	results := make([]LibraryResult, len(library.Novels))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, entry := range library.Novels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i] = LibraryResult{Entry: entry, Err: ctx.Err()}
+				return
+			}
+			results[i] = updateLibraryEntry(ctx, entry, opts)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// updateLibraryEntry 更新书库中的一本小说，还没有爬取过的小说按照书库中的爬取模式开始爬取
+func updateLibraryEntry(ctx context.Context, entry *models.LibraryEntry, opts Options) LibraryResult {
+	result := LibraryResult{Entry: entry}
+	opts.EPUB = entry.HasFormat(models.FormatEPUB)
+
+	ws, err := utils.OpenWorkspace(entry.ID)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		result.Err = fmt.Errorf("读取章节清单失败: %v", err)
+		return result
+	}
+	before := manifest.Count(models.ChapterDone)
+
+	log.Printf("开始更新书库中的小说 %s\n", entry.ID)
+	switch {
+	case before > 0:
+		_, result.Err = UpdateNovel(ctx, entry.ID, opts)
+	case entry.Mode == models.ModeFollow:
+		result.Err = LoadNovelFromFirstChapterLink(ctx, entry.URL, opts)
+	default:
+		result.Err = LoadNovelFromCategoryChapterLink(ctx, entry.URL, opts)
+	}
+
+	if manifest, err := utils.LoadManifest(ws); err == nil {
+		result.TotalChapters = manifest.Count(models.ChapterDone)
+		result.NewChapters = result.TotalChapters - before
+	}
+	if result.Err == nil && result.TotalChapters > 0 {
+		result.Err = exportLibraryDocuments(ws, entry)
+	}
+
+	// 记录检查结果
+	err = utils.UpdateLibrary(func(library *models.Library) error {
+		e := library.Find(entry.ID)
+		if e == nil {
+			// 更新期间已经从书库中移除
+			return nil
+		}
+		if meta, err := ws.LoadMeta(); err == nil && meta != nil && meta.Title != "" {
+			e.Title = meta.Title
+		}
+		e.LastCheckedTime = time.Now().Unix()
+		e.LastChapterCount = result.TotalChapters
+		e.LastError = ""
+		if result.Err != nil {
+			e.LastError = result.Err.Error()
+		}
+		result.Entry = e
+		return nil
+	})
+	if err != nil {
+		log.Printf("更新书库失败: %v\n", err)
+	}
+	return result
+}
+
+// exportLibraryDocuments 导出书库中要求的 EPUB、HTML 和 Markdown 格式。
+// 有新章节时 UpdateNovel 已经重新导出过，这里只导出还没有或者比合并文件旧的文件
+func exportLibraryDocuments(ws *utils.Workspace, entry *models.LibraryEntry) error {
+	meta, err := ws.LoadMeta()
+	if err != nil || meta == nil || meta.Title == "" {
+		return nil
+	}
+	if entry.HasFormat(models.FormatEPUB) && exportOutdated(ws, ws.EPUBFilePath(meta.Title), meta.Title) {
+		if err := ExportEPUB(ws, ""); err != nil {
+			return err
+		}
+	}
+	if entry.HasFormat(models.FormatHTML) && exportOutdated(ws, ws.HTMLFilePath(meta.Title), meta.Title) {
+		if err := ExportHTML(ws); err != nil {
+			return err
+		}
+	}
+	if entry.HasFormat(models.FormatMarkdown) && exportOutdated(ws, ws.MarkdownFilePath(meta.Title), meta.Title) {
+		if err := ExportMarkdown(ws); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// TestUpdateLibraryExportsOutdated 没有新章节时，还没有导出或者比合并文件旧的格式也要重新导出
+func TestUpdateLibraryExportsOutdated(t *testing.T) {
+	site := startTestSite(t)
+	entry := &models.LibraryEntry{
+		URL:     fmt.Sprintf("%s/book/1/1.html", site),
+		Mode:    models.ModeFollow,
+		Formats: []string{models.FormatTXT, models.FormatEPUB, models.FormatHTML},
+	}
+	if err := AddToLibrary(entry); err != nil {
+		t.Fatal(err)
+	}
+	update := func() {
+		t.Helper()
+		results, err := UpdateLibrary(context.Background(), 1, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Err != nil {
+			t.Fatalf("更新失败: %v", results[0].Err)
+		}
+	}
+	update()
+
+	ws, err := utils.FindWorkspace(entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	epubPath := ws.EPUBFilePath("测试小说")
+	htmlPath := ws.HTMLFilePath("测试小说")
+	mergedPath := ws.MergedFilePath("测试小说")
+
+	// 模拟上次更新时导出 EPUB 之前被中断，HTML 还是更早的版本
+	if err := os.Remove(epubPath); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(htmlPath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	update()
+
+	merged, err := os.Stat(mergedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{epubPath, htmlPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("没有重新导出 %s: %v", path, err)
+			continue
+		}
+		if info.ModTime().Before(merged.ModTime()) {
+			t.Errorf("%s 比合并文件旧", path)
+		}
+	}
+}
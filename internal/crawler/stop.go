@@ -0,0 +1,27 @@
+package crawler
+
+import "context"
+
+type stopKey struct{}
+
+// WithStop 返回附加了停止信号的上下文，stop 关闭后不再开始爬取新的章节，
+// 正在爬取的章节会继续完成并保存，上下文本身不会被取消
+func WithStop(ctx context.Context, stop <-chan struct{}) context.Context {
+	return context.WithValue(ctx, stopKey{}, stop)
+}
+
+// Stopped 返回上下文中的停止信号，没有停止信号时返回 nil
+func Stopped(ctx context.Context) <-chan struct{} {
+	stop, _ := ctx.Value(stopKey{}).(<-chan struct{})
+	return stop
+}
+
+// stopping 检查是否已经收到停止信号
+func stopping(ctx context.Context) bool {
+	select {
+	case <-Stopped(ctx):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"chromedp-scraper/internal/fetcher"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/scraper"
+	"chromedp-scraper/internal/utils"
+)
+
+// UpdateNovel 检查已经爬取过的小说是否有新章节，只下载新章节并追加到合并文件，
+// 目录模式的小说重新读取目录并和章节清单比较，顺序模式的小说从最后保存的章节沿下一章链接继续，
+// 已经导出过 EPUB 时重新导出，EPUB 不存在或者比合并文件旧时也会导出，返回新下载的章节数
+func UpdateNovel(ctx context.Context, key string, opts Options) (int, error) {
+	opts = opts.normalize()
+	ctx, opts = withWatermarks(ctx, opts)
+
+	ws, err := utils.FindWorkspace(key)
+	if err != nil {
+		return 0, err
+	}
+	ctx, unlock, err := utils.LockWorkspace(ctx, ws)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if err := utils.RecoverWorkspace(ws); err != nil {
+		return 0, fmt.Errorf("修复工作目录失败: %v", err)
+	}
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		return 0, fmt.Errorf("读取章节清单失败: %v", err)
+	}
+	meta, err := ws.LoadMeta()
+	if err != nil || meta == nil {
+		return 0, fmt.Errorf("读取小说信息失败: %v", err)
+	}
+	before := manifest.Count(models.ChapterDone)
+
+	// 已经导出过 EPUB 时，更新后重新导出
+	epub := opts.EPUB
+	if _, err := os.Stat(ws.EPUBFilePath(meta.Title)); err == nil {
+		epub = true
+	}
+
+	if manifest.Mode == models.ModeCatalog {
+		if meta.SourceURL == "" {
+			return 0, fmt.Errorf("小说《%s》没有目录页链接", key)
+		}
+		log.Printf("重新读取目录页，检查小说《%s》的新章节: %s\n", meta.Title, meta.SourceURL)
+		opts.EPUB = false
+		// 目录页需要重新验证才能发现新章节，已经缓存的章节页仍然可以直接使用
+		if err := LoadNovelFromCategoryChapterLink(fetcher.WithRevalidate(ctx, fetcher.PageCatalog), meta.SourceURL, opts); err != nil {
+			return 0, err
+		}
+	} else if err := updateFollow(ctx, ws, manifest, opts); err != nil {
+		return 0, err
+	}
+
+	if manifest, err = utils.LoadManifest(ws); err != nil {
+		return 0, fmt.Errorf("读取章节清单失败: %v", err)
+	}
+	added := manifest.Count(models.ChapterDone) - before
+	log.Printf("小说《%s》更新完成，新增 %d 章\n", meta.Title, added)
+
+	if epub && (added > 0 || exportOutdated(ws, ws.EPUBFilePath(meta.Title), meta.Title)) {
+		if err := ExportEPUB(ws, opts.CoverPath); err != nil {
+			return added, err
+		}
+	}
+	if added > 0 {
+		if err := reexportDocuments(ws, meta.Title); err != nil {
+			return added, err
+		}
+	}
+	return added, nil
+}
+
+// updateFollow 重新爬取最后保存的章节以获取最新的下一章链接，然后沿下一章链接爬取新章节
+func updateFollow(ctx context.Context, ws *utils.Workspace, manifest *models.Manifest, opts Options) error {
+	last := manifest.LastDone()
+	if last == nil {
+		return fmt.Errorf("小说《%s》还没有爬取过任何章节", manifest.Title)
+	}
+
+	novel := loadNovel(ws, last.URL)
+	if novel.Title == "未命名" && manifest.Title != "" {
+		novel.Title = manifest.Title
+	}
+
+	startURL := last.URL
+	if startURL == "" {
+		startURL = last.NextURL
+	}
+	if startURL == "" {
+		return fmt.Errorf("小说《%s》没有可以继续的章节链接", manifest.Title)
+	}
+
+	// 创建浏览器上下文
+	ctx, cancel, err := newBrowserContext(ctx, startURL, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	nextURL := last.NextURL
+	if last.URL != "" {
+		// 最后一章发布时可能还没有下一章链接，重新爬取获取最新的链接
+		log.Printf("检查第 %d 章的下一章链接: %s\n", last.Index, last.URL)
+		chapter, err := scraper.RetryScrapeChapter(fetcher.WithRevalidate(ctx, fetcher.PageChapter), last.URL, nil, novel)
+		if err != nil {
+			return fmt.Errorf("爬取第 %d 章失败: %v", last.Index, err)
+		}
+		nextURL = chapter.NextLink
+		if err := utils.UpdateManifest(ws, func(m *models.Manifest) {
+			m.Record(last.Index).NextURL = nextURL
+		}); err != nil {
+			log.Printf("更新章节清单失败: %v\n", err)
+		}
+	}
+	if nextURL == "" {
+		log.Printf("小说《%s》没有新章节\n", manifest.Title)
+		return nil
+	}
+
+	return followChapters(ctx, ws, novel, nextURL, last.Index+1, opts)
+}
@@ -0,0 +1,195 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/scraper"
+	"chromedp-scraper/internal/utils"
+)
+
+// WatermarkCandidate 在一本或多本小说中检测到的疑似水印
+type WatermarkCandidate struct {
+	*scraper.WatermarkCandidate
+	// 出现这一行的小说标识
+	Novels []string
+}
+
+// WatermarkResult 删除一本小说中水印的结果
+type WatermarkResult struct {
+	ID    string
+	Title string
+	// 修改的章节数
+	Changed int
+	Err     error
+}
+
+// DetectWatermarks 分别检测每本小说中疑似水印的行，key 为空时检测所有小说，
+// 同一网站的多本小说中出现的相同规则合并为一个
+func DetectWatermarks(key string, opts scraper.WatermarkOptions) ([]*WatermarkCandidate, error) {
+	workspaces, err := watermarkWorkspaces(key)
+	if err != nil {
+		return nil, err
+	}
+
+	byRule := make(map[string]*WatermarkCandidate)
+	for _, ws := range workspaces {
+		meta, err := ws.LoadMeta()
+		if err != nil || meta == nil || meta.Title == "" {
+			continue
+		}
+		stored, err := utils.LoadStoredChapters(ws, meta.Title)
+		if err != nil {
+			log.Printf("读取小说《%s》的章节失败: %v\n", meta.Title, err)
+			continue
+		}
+		chapters := make([]*models.Chapter, 0, len(stored))
+		for _, s := range stored {
+			chapters = append(chapters, s.Chapter)
+		}
+
+		for _, c := range scraper.DetectWatermarks(chapters, opts) {
+			c.Rule.Host = novelHost(meta)
+			ruleKey := c.Rule.Key()
+			if existing := byRule[ruleKey]; existing != nil {
+				existing.Chapters += c.Chapters
+				existing.Total += c.Total
+				existing.Novels = append(existing.Novels, ws.ID)
+				continue
+			}
+			c.Rule.Source = ws.ID
+			byRule[ruleKey] = &WatermarkCandidate{WatermarkCandidate: c, Novels: []string{ws.ID}}
+		}
+	}
+
+	candidates := make([]*WatermarkCandidate, 0, len(byRule))
+	for _, c := range byRule {
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i].Novels) != len(candidates[j].Novels) {
+			return len(candidates[i].Novels) > len(candidates[j].Novels)
+		}
+		if candidates[i].Chapters != candidates[j].Chapters {
+			return candidates[i].Chapters > candidates[j].Chapters
+		}
+		return candidates[i].Example < candidates[j].Example
+	})
+	return candidates, nil
+}
+
+// LearnWatermarks 把规则加入水印规则文件，已经存在的规则不会重复加入，返回新加入的规则数
+func LearnWatermarks(rules []models.WatermarkRule) (int, error) {
+	added := 0
+	err := utils.UpdateWatermarks(func(watermarks *models.Watermarks) {
+		existing := make(map[string]bool)
+		for _, rule := range watermarks.Rules {
+			existing[rule.Key()] = true
+		}
+		for _, rule := range rules {
+			if existing[rule.Key()] {
+				continue
+			}
+			existing[rule.Key()] = true
+			rule.AddedTime = time.Now().Unix()
+			watermarks.Rules = append(watermarks.Rules, &rule)
+			added++
+		}
+	})
+	return added, err
+}
+
+// RemoveWatermarks 按照水印规则文件中每本小说所属网站的规则，删除已经保存的章节中的水印行，
+// key 为空时处理所有小说，修改过章节并且导出过 EPUB 的小说会重新导出
+func RemoveWatermarks(ctx context.Context, key string) ([]*WatermarkResult, error) {
+	watermarks, err := utils.LoadWatermarks()
+	if err != nil {
+		return nil, fmt.Errorf("读取水印规则失败: %v", err)
+	}
+	if len(watermarks.Rules) == 0 {
+		return nil, fmt.Errorf("还没有水印规则")
+	}
+	workspaces, err := watermarkWorkspaces(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*WatermarkResult
+	for _, ws := range workspaces {
+		if stopping(ctx) {
+			break
+		}
+		result := &WatermarkResult{ID: ws.ID}
+		result.Title, result.Changed, result.Err = removeWatermarks(ctx, ws, watermarks)
+		if result.Title == "" && result.Err == nil {
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// removeWatermarks 删除一本小说中的水印行，返回小说标题和修改的章节数
+func removeWatermarks(ctx context.Context, ws *utils.Workspace, watermarks *models.Watermarks) (string, int, error) {
+	_, unlock, err := utils.LockWorkspace(ctx, ws)
+	if err != nil {
+		return "", 0, err
+	}
+	defer unlock()
+	if err := utils.RecoverWorkspace(ws); err != nil {
+		return "", 0, fmt.Errorf("修复工作目录失败: %v", err)
+	}
+	meta, err := ws.LoadMeta()
+	if err != nil || meta == nil || meta.Title == "" {
+		return "", 0, nil
+	}
+	rules := watermarks.ForHost(novelHost(meta))
+	if len(rules) == 0 {
+		return meta.Title, 0, nil
+	}
+
+	changed, err := utils.RewriteStoredChapters(ws, meta.Title, func(index int, chapter *models.Chapter) bool {
+		return scraper.RemoveChapterWatermarks(chapter, rules)
+	})
+	if err != nil {
+		return meta.Title, changed, err
+	}
+	log.Printf("小说《%s》删除水印完成，修改了 %d 章\n", meta.Title, changed)
+
+	// 合并文件已经直接修改，EPUB、HTML 和 Markdown 需要重新导出
+	if changed == 0 {
+		return meta.Title, changed, nil
+	}
+	if _, err := os.Stat(ws.EPUBFilePath(meta.Title)); err == nil {
+		if err := ExportEPUB(ws, ""); err != nil {
+			return meta.Title, changed, err
+		}
+	}
+	return meta.Title, changed, reexportDocuments(ws, meta.Title)
+}
+
+// novelHost 返回小说所属网站配置的 host，没有网站配置时返回空字符串
+func novelHost(meta *models.NovelMeta) string {
+	if siteConfig := config.GetSiteConfig(meta.SourceURL); siteConfig != nil {
+		return siteConfig.Host
+	}
+	return ""
+}
+
+// watermarkWorkspaces 返回需要处理的工作目录，key 为空时返回所有工作目录
+func watermarkWorkspaces(key string) ([]*utils.Workspace, error) {
+	if key == "" {
+		return utils.ListWorkspaces()
+	}
+	ws, err := utils.FindWorkspace(key)
+	if err != nil {
+		return nil, err
+	}
+	return []*utils.Workspace{ws}, nil
+}
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chromedp-scraper/internal/models"
+)
+
+// chapterBlocks 返回导出时使用的章节内容块，没有内容块的章节按行拆分正文，
+// 包含多行的内容块拆分为每行一个
+func chapterBlocks(chapter *models.Chapter) []models.Block {
+	if chapter.Blocks == nil {
+		return models.TextBlocks(chapter.Content)
+	}
+	var blocks []models.Block
+	for _, block := range chapter.Blocks {
+		if block.Type == models.BlockImage || !strings.Contains(block.Text, "\n") {
+			blocks = append(blocks, block)
+			continue
+		}
+		for _, line := range strings.Split(block.Text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				blocks = append(blocks, models.Block{Type: block.Type, Text: line})
+			}
+		}
+	}
+	return blocks
+}
+
+// localImage 返回图片内容块在 imageDir 中的文件路径，图片没有下载或者文件不存在时返回 false
+func localImage(imageDir string, block models.Block) (string, bool) {
+	if imageDir == "" || block.File == "" || block.File != filepath.Base(block.File) {
+		return "", false
+	}
+	if _, ok := imageMediaTypes[strings.ToLower(filepath.Ext(block.File))]; !ok {
+		return "", false
+	}
+	path := filepath.Join(imageDir, block.File)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// renderXHTML 把内容块转换为 XHTML 片段，EPUB 和 HTML 共用。
+// imageSrc 返回图片在导出文件中的链接，返回空字符串时不输出这张图片
+func renderXHTML(blocks []models.Block, indent string, imageSrc func(models.Block) string) string {
+	var b strings.Builder
+	for _, block := range blocks {
+		text := html.EscapeString(block.Text)
+		switch block.Type {
+		case models.BlockParagraph:
+			b.WriteString(indent + "<p>" + text + "</p>\n")
+		case models.BlockHeading:
+			b.WriteString(indent + "<h3>" + text + "</h3>\n")
+		case models.BlockSeparator:
+			b.WriteString(indent + "<hr class=\"separator\"/>\n")
+		case models.BlockAuthorNote:
+			b.WriteString(indent + "<p class=\"author-note\">" + text + "</p>\n")
+		case models.BlockImage:
+			if src := imageSrc(block); src != "" {
+				b.WriteString(indent + "<div class=\"image\"><img src=\"" + html.EscapeString(src) + "\" alt=\"" + html.EscapeString(block.Alt) + "\"/></div>\n")
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,399 @@
+package export
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"chromedp-scraper/internal/models"
+)
+
+// EPUBOptions EPUB 导出选项
+type EPUBOptions struct {
+	// 封面图片路径，支持 jpg、png、gif、webp，为空表示没有封面
+	CoverPath string
+	// 语言，默认 zh-CN
+	Language string
+	// 章节图片所在的目录，图片内容块的文件在这个目录中
+	ImageDir string
+}
+
+// epubChapter 模板中使用的章节信息
+type epubChapter struct {
+	ID    string
+	File  string
+	Title string
+	// 由内容块生成的正文 XHTML
+	Body string
+}
+
+// epubImage 章节中的图片
+type epubImage struct {
+	ID        string
+	File      string
+	MediaType string
+	// 图片文件的路径
+	path string
+}
+
+// epubBook 模板中使用的书籍信息
+type epubBook struct {
+	Identifier string
+	Title      string
+	Author     string
+	Source     string
+	Language   string
+	Modified   string
+	CoverFile  string
+	CoverType  string
+	Chapters   []epubChapter
+	Images     []epubImage
+}
+
+// WriteEPUB 将小说导出为 EPUB 3 文件，每个章节一个 XHTML 文件，
+// 同时生成导航文档和 NCX 目录
+func WriteEPUB(path string, novel *models.Novel, opts EPUBOptions) error {
+	if len(novel.Chapters) == 0 {
+		return fmt.Errorf("小说《%s》没有章节，无法导出", novel.Title)
+	}
+
+	book := newEPUBBook(novel, opts)
+
+	var cover []byte
+	if opts.CoverPath != "" {
+		data, err := os.ReadFile(opts.CoverPath)
+		if err != nil {
+			return fmt.Errorf("读取封面失败: %v", err)
+		}
+		mediaType, ok := imageMediaTypes[strings.ToLower(filepath.Ext(opts.CoverPath))]
+		if !ok {
+			return fmt.Errorf("不支持的封面格式: %s", opts.CoverPath)
+		}
+		cover = data
+		book.CoverFile = "cover" + strings.ToLower(filepath.Ext(opts.CoverPath))
+		book.CoverType = mediaType
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeEPUB(f, book, cover); err != nil {
+		return fmt.Errorf("生成 EPUB 失败: %v", err)
+	}
+	return f.Close()
+}
+
+// newEPUBBook 根据小说信息生成模板数据
+func newEPUBBook(novel *models.Novel, opts EPUBOptions) *epubBook {
+	book := &epubBook{
+		Identifier: bookIdentifier(novel),
+		Title:      novel.Title,
+		Author:     novel.Author,
+		Source:     novel.SourceURL,
+		Language:   opts.Language,
+		Modified:   time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if book.Language == "" {
+		book.Language = "zh-CN"
+	}
+	if book.Author == "" {
+		book.Author = "未知"
+	}
+
+	// EPUB 中不能引用网络图片，只输出已经下载到本地的图片，相同的图片只打包一份
+	images := make(map[string]bool)
+	imageSrc := func(block models.Block) string {
+		path, ok := localImage(opts.ImageDir, block)
+		if !ok {
+			return ""
+		}
+		if !images[block.File] {
+			images[block.File] = true
+			book.Images = append(book.Images, epubImage{
+				ID:        fmt.Sprintf("image_%04d", len(book.Images)+1),
+				File:      block.File,
+				MediaType: imageMediaTypes[strings.ToLower(filepath.Ext(block.File))],
+				path:      path,
+			})
+		}
+		return "../images/" + block.File
+	}
+
+	for i, chapter := range novel.Chapters {
+		book.Chapters = append(book.Chapters, epubChapter{
+			ID:    fmt.Sprintf("chapter_%04d", i+1),
+			File:  fmt.Sprintf("text/chapter_%04d.xhtml", i+1),
+			Title: chapter.Title,
+			Body:  renderXHTML(chapterBlocks(chapter), "    ", imageSrc),
+		})
+	}
+	return book
+}
+
+// bookIdentifier 根据来源URL（没有时使用标题）生成稳定的 urn:uuid 标识
+func bookIdentifier(novel *models.Novel) string {
+	key := novel.SourceURL
+	if key == "" {
+		key = novel.Title
+	}
+	sum := sha1.Sum([]byte(key))
+	sum[6] = (sum[6] & 0x0f) | 0x50 // 版本 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 变体
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// epubFile 由模板生成的文件
+type epubFile struct {
+	name string
+	tmpl *template.Template
+}
+
+// writeEPUB 写入 EPUB 压缩包，mimetype 必须是第一个且不压缩的文件
+func writeEPUB(w io.Writer, book *epubBook, cover []byte) error {
+	zw := zip.NewWriter(w)
+
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []epubFile{
+		{"META-INF/container.xml", containerTemplate},
+		{"OEBPS/content.opf", opfTemplate},
+		{"OEBPS/nav.xhtml", navTemplate},
+		{"OEBPS/toc.ncx", ncxTemplate},
+	}
+	if book.CoverFile != "" {
+		files = append(files, epubFile{"OEBPS/text/cover.xhtml", coverTemplate})
+	}
+	for _, file := range files {
+		fw, err := createFile(zw, file.name)
+		if err != nil {
+			return err
+		}
+		if err := file.tmpl.Execute(fw, book); err != nil {
+			return err
+		}
+	}
+
+	for _, chapter := range book.Chapters {
+		fw, err := createFile(zw, "OEBPS/" + chapter.File)
+		if err != nil {
+			return err
+		}
+		if err := chapterTemplate.Execute(fw, struct {
+			Language string
+			epubChapter
+		}{book.Language, chapter}); err != nil {
+			return err
+		}
+	}
+
+	fw, err := createFile(zw, "OEBPS/style.css")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, styleCSS); err != nil {
+		return err
+	}
+
+	if book.CoverFile != "" {
+		fw, err := createFile(zw, "OEBPS/images/" + book.CoverFile)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(cover); err != nil {
+			return err
+		}
+	}
+
+	// 图片已经压缩过，不再压缩
+	for _, image := range book.Images {
+		data, err := os.ReadFile(image.path)
+		if err != nil {
+			return err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/images/" + image.File, Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// createFile 在压缩包中创建使用 Deflate 压缩的文件
+func createFile(zw *zip.Writer, name string) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+}
+
+// imageMediaTypes 支持的图片格式
+var imageMediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// 模板函数：xml 转义文本，inc 用于生成从 1 开始的序号
+var templateFuncs = template.FuncMap{
+	"xml": html.EscapeString,
+	"inc": func(i int) int { return i + 1 },
+}
+
+func newTemplate(name, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(templateFuncs).Parse(text))
+}
+
+var containerTemplate = newTemplate("container", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`)
+
+var opfTemplate = newTemplate("opf", `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{.Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{.Identifier}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:creator>{{xml .Author}}</dc:creator>
+    <dc:language>{{.Language}}</dc:language>
+{{- if .Source}}
+    <dc:source>{{xml .Source}}</dc:source>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+{{- if .CoverFile}}
+    <meta name="cover" content="cover-image"/>
+{{- end}}
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- if .CoverFile}}
+    <item id="cover-image" href="images/{{.CoverFile}}" media-type="{{.CoverType}}" properties="cover-image"/>
+    <item id="cover" href="text/cover.xhtml" media-type="application/xhtml+xml"/>
+{{- end}}
+{{- range .Chapters}}
+    <item id="{{.ID}}" href="{{.File}}" media-type="application/xhtml+xml"/>
+{{- end}}
+{{- range .Images}}
+    <item id="{{.ID}}" href="images/{{.File}}" media-type="{{.MediaType}}"/>
+{{- end}}
+  </manifest>
+  <spine toc="ncx">
+{{- if .CoverFile}}
+    <itemref idref="cover" linear="no"/>
+{{- end}}
+{{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+{{- end}}
+  </spine>
+</package>
+`)
+
+var navTemplate = newTemplate("nav", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>目录</h1>
+    <ol>
+{{- range .Chapters}}
+      <li><a href="{{.File}}">{{xml .Title}}</a></li>
+{{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+`)
+
+var ncxTemplate = newTemplate("ncx", `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1" xml:lang="{{.Language}}">
+  <head>
+    <meta name="dtb:uid" content="{{.Identifier}}"/>
+    <meta name="dtb:depth" content="1"/>
+    <meta name="dtb:totalPageCount" content="0"/>
+    <meta name="dtb:maxPageNumber" content="0"/>
+  </head>
+  <docTitle><text>{{xml .Title}}</text></docTitle>
+  <docAuthor><text>{{xml .Author}}</text></docAuthor>
+  <navMap>
+{{- range $i, $c := .Chapters}}
+    <navPoint id="nav-{{$c.ID}}" playOrder="{{inc $i}}">
+      <navLabel><text>{{xml $c.Title}}</text></navLabel>
+      <content src="{{$c.File}}"/>
+    </navPoint>
+{{- end}}
+  </navMap>
+</ncx>
+`)
+
+var coverTemplate = newTemplate("cover", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="../style.css"/>
+</head>
+<body epub:type="cover">
+  <div class="cover"><img src="../images/{{.CoverFile}}" alt="{{xml .Title}}"/></div>
+</body>
+</html>
+`)
+
+var chapterTemplate = newTemplate("chapter", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}" lang="{{.Language}}">
+<head>
+  <title>{{xml .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="../style.css"/>
+</head>
+<body>
+  <section epub:type="chapter">
+    <h2>{{xml .Title}}</h2>
+{{.Body}}
+  </section>
+</body>
+</html>
+`)
+
+const styleCSS = `body { margin: 0 5%; line-height: 1.8; }
+h1, h2 { text-align: center; margin: 1em 0; }
+p { text-indent: 2em; margin: 0.5em 0; }
+h3 { text-align: center; margin: 1em 0 0.5em; }
+hr.separator { border: none; margin: 1em 0; text-align: center; }
+hr.separator::after { content: "＊　＊　＊"; }
+p.author-note { text-indent: 0; font-size: 0.9em; color: #666; }
+.image { text-align: center; margin: 1em 0; }
+.image img { max-width: 100%; }
+nav ol { list-style: none; padding: 0; }
+.cover { text-align: center; }
+.cover img { max-width: 100%; max-height: 100%; }
+`
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chromedp-scraper/internal/models"
+)
+
+// htmlChapter 模板中使用的章节信息
+type htmlChapter struct {
+	ID    string
+	Title string
+	Body  string
+}
+
+// htmlBook 模板中使用的书籍信息
+type htmlBook struct {
+	Title    string
+	Author   string
+	Source   string
+	Language string
+	Style    string
+	Chapters []htmlChapter
+}
+
+// WriteHTML 将小说导出为单个 HTML 文件，开头是目录，每个章节一个 <section>。
+// imageDir 中已经下载的图片以 data URI 嵌入文件中，没有下载的图片引用原来的链接
+func WriteHTML(path string, novel *models.Novel, imageDir string) error {
+	if len(novel.Chapters) == 0 {
+		return fmt.Errorf("小说《%s》没有章节，无法导出", novel.Title)
+	}
+
+	book := &htmlBook{
+		Title:    novel.Title,
+		Author:   novel.Author,
+		Source:   novel.SourceURL,
+		Language: "zh-CN",
+		Style:    styleCSS,
+	}
+	if book.Author == "" {
+		book.Author = "未知"
+	}
+	imageSrc := func(block models.Block) string {
+		path, ok := localImage(imageDir, block)
+		if !ok {
+			return block.Src
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("读取图片 %s 失败: %v\n", path, err)
+			return block.Src
+		}
+		mediaType := imageMediaTypes[strings.ToLower(filepath.Ext(path))]
+		return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	for i, chapter := range novel.Chapters {
+		book.Chapters = append(book.Chapters, htmlChapter{
+			ID:    fmt.Sprintf("chapter_%04d", i+1),
+			Title: chapter.Title,
+			Body:  renderXHTML(chapterBlocks(chapter), "    ", imageSrc),
+		})
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := htmlTemplate.Execute(f, book); err != nil {
+		return fmt.Errorf("生成 HTML 失败: %v", err)
+	}
+	return f.Close()
+}
+
+var htmlTemplate = newTemplate("html", `<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+  <meta charset="utf-8"/>
+  <meta name="viewport" content="width=device-width, initial-scale=1"/>
+  <title>{{xml .Title}}</title>
+  <style>
+{{.Style}}  </style>
+</head>
+<body>
+  <h1>{{xml .Title}}</h1>
+  <p class="author-note">作者：{{xml .Author}}{{if .Source}}　来源：<a href="{{xml .Source}}">{{xml .Source}}</a>{{end}}</p>
+  <nav>
+    <ol>
+{{- range .Chapters}}
+      <li><a href="#{{.ID}}">{{xml .Title}}</a></li>
+{{- end}}
+    </ol>
+  </nav>
+{{- range .Chapters}}
+  <section id="{{.ID}}">
+    <h2>{{xml .Title}}</h2>
+{{.Body}}
+  </section>
+{{- end}}
+</body>
+</html>
+`)
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"chromedp-scraper/internal/models"
+)
+
+// WriteMarkdown 将小说导出为单个 Markdown 文件，章节标题为二级标题，
+// 正文中的小标题为三级标题，作者的话为引用。
+// imageDir 中已经下载的图片使用相对于导出文件的路径，没有下载的图片引用原来的链接
+func WriteMarkdown(path string, novel *models.Novel, imageDir string) error {
+	if len(novel.Chapters) == 0 {
+		return fmt.Errorf("小说《%s》没有章节，无法导出", novel.Title)
+	}
+
+	var b strings.Builder
+	b.WriteString("# " + markdownEscape(novel.Title) + "\n\n")
+	author := novel.Author
+	if author == "" {
+		author = "未知"
+	}
+	b.WriteString("作者：" + markdownEscape(author) + "\n")
+	if novel.SourceURL != "" {
+		b.WriteString("\n来源：<" + novel.SourceURL + ">\n")
+	}
+
+	for _, chapter := range novel.Chapters {
+		b.WriteString("\n## " + markdownEscape(chapter.Title) + "\n")
+		for _, block := range chapterBlocks(chapter) {
+			b.WriteString("\n")
+			switch block.Type {
+			case models.BlockHeading:
+				b.WriteString("### " + markdownEscape(block.Text) + "\n")
+			case models.BlockSeparator:
+				b.WriteString("---\n")
+			case models.BlockAuthorNote:
+				b.WriteString("> " + markdownEscape(block.Text) + "\n")
+			case models.BlockImage:
+				b.WriteString("![" + markdownEscape(block.Alt) + "](<" + markdownImageSrc(path, imageDir, block) + ">)\n")
+			default:
+				b.WriteString(markdownEscape(block.Text) + "\n")
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("生成 Markdown 失败: %v", err)
+	}
+	return nil
+}
+
+// markdownImageSrc 返回图片相对于 Markdown 文件的路径，没有下载的图片返回原来的链接
+func markdownImageSrc(path, imageDir string, block models.Block) string {
+	imagePath, ok := localImage(imageDir, block)
+	if !ok {
+		return block.Src
+	}
+	rel, err := filepath.Rel(filepath.Dir(path), imagePath)
+	if err != nil {
+		return block.Src
+	}
+	return filepath.ToSlash(rel)
+}
+
+// markdownSpecial 需要转义的 Markdown 符号
+var markdownSpecial = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `#`, `\#`, `|`, `\|`,
+)
+
+// markdownListPrefix 匹配会被当作列表或引用的行首，例如 "1. "、"- "、"> "
+var markdownListPrefix = regexp.MustCompile(`^(\d+)([.)])|^([-+>=])`)
+
+// markdownEscape 转义文本中的 Markdown 符号，正文按原样显示
+func markdownEscape(s string) string {
+	s = markdownSpecial.Replace(s)
+	return markdownListPrefix.ReplaceAllString(s, `$1\$2$3`)
+}
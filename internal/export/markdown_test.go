@@ -0,0 +1,26 @@
+package export
+
+import "testing"
+
+func TestMarkdownEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"普通文字", "他笑了笑。", "他笑了笑。"},
+		{"强调和链接符号", "*星号*和[方括号]", `\*星号\*和\[方括号\]`},
+		{"标题符号", "#话题", `\#话题`},
+		{"有序列表", "1. 第一条", `1\. 第一条`},
+		{"无序列表", "- 破折号开头", `\- 破折号开头`},
+		{"引用", "> 引用", `\> 引用`},
+		{"HTML 标签", "<br>", `\<br>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownEscape(tt.text); got != tt.want {
+				t.Errorf("markdownEscape(%q) = %q，期望 %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"chromedp-scraper/internal/utils"
+)
+
+// 页面类型，不同类型的页面使用不同的缓存有效期
+const (
+	// PageCatalog 目录页，会随着新章节发布而变化
+	PageCatalog = "catalog"
+	// PageChapter 章节页，发布后基本不会变化
+	PageChapter = "chapter"
+)
+
+// PageTypes 所有的页面类型
+var PageTypes = []string{PageCatalog, PageChapter}
+
+// pageCache 页面缓存，为 nil 时不使用缓存
+var pageCache *PageCache
+
+// PageCache 保存在磁盘上的页面缓存。
+// index/ 下按 URL 保存页面信息，页面内容按照内容的哈希值保存在 objects/ 下，相同内容只保存一份
+type PageCache struct {
+	Dir string
+	// 每种页面类型的有效期，0 表示永不过期
+	TTLs map[string]time.Duration
+
+	mu sync.Mutex
+}
+
+// cacheEntry 缓存的页面信息
+type cacheEntry struct {
+	URL          string `json:"url"`
+	FinalURL     string `json:"finalUrl"`
+	StatusCode   int    `json:"statusCode"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	PageType     string `json:"pageType"`
+	// 页面内容的 SHA-256
+	Object      string `json:"object"`
+	FetchedTime int64  `json:"fetchedTime"`
+	// 最后一次确认页面没有变化的时间，用于计算是否过期
+	CheckedTime int64 `json:"checkedTime"`
+}
+
+// CacheStats 缓存的统计信息
+type CacheStats struct {
+	// 每种页面类型的页面数和其中已经过期的页面数
+	Pages   map[string]int
+	Expired map[string]int
+	// 页面内容文件数和总大小
+	Objects int
+	Bytes   int64
+}
+
+// EnableCache 使用 dir 中的页面缓存
+func EnableCache(dir string, ttls map[string]time.Duration) {
+	pageCache = &PageCache{Dir: dir, TTLs: ttls}
+}
+
+// DisableCache 停止使用页面缓存，用于在测试结束后恢复默认的设置
+func DisableCache() {
+	pageCache = nil
+}
+
+// Cache 返回正在使用的页面缓存，没有使用缓存时返回 nil
+func Cache() *PageCache {
+	return pageCache
+}
+
+type pageTypeKey struct{}
+
+type revalidateKey struct{}
+
+// WithPageType 设置抓取的页面类型
+func WithPageType(ctx context.Context, pageType string) context.Context {
+	return context.WithValue(ctx, pageTypeKey{}, pageType)
+}
+
+// PageType 返回抓取的页面类型，没有设置时为空
+func PageType(ctx context.Context) string {
+	pageType, _ := ctx.Value(pageTypeKey{}).(string)
+	return pageType
+}
+
+// WithRevalidate 让指定类型的页面即使在缓存中没有过期也重新验证，
+// 用于检查更新时重新读取目录页，或者重新检查最后一章是否已经有了下一章链接
+func WithRevalidate(ctx context.Context, pageTypes ...string) context.Context {
+	return context.WithValue(ctx, revalidateKey{}, pageTypes)
+}
+
+func revalidating(ctx context.Context) bool {
+	pageTypes, _ := ctx.Value(revalidateKey{}).([]string)
+	return slices.Contains(pageTypes, PageType(ctx))
+}
+
+// CachedPage 返回缓存中没有过期的页面，没有可用的缓存时返回 nil，
+// 使用缓存的页面不需要等待访问频率限制
+func CachedPage(ctx context.Context, url string) *Page {
+	c := pageCache
+	if c == nil || revalidating(ctx) {
+		return nil
+	}
+	entry, err := c.load(url)
+	if err != nil || entry == nil || c.expired(entry, time.Now()) {
+		return nil
+	}
+	page, err := c.page(entry)
+	if err != nil {
+		log.Printf("读取缓存的页面 %s 失败: %v\n", url, err)
+		return nil
+	}
+	if recordDir != "" {
+		if err := savePage(recordDir, page); err != nil {
+			log.Printf("记录页面 %s 失败: %v\n", url, err)
+		}
+	}
+	return page
+}
+
+// EvictPages 从缓存中删除页面，用于页面内容无法解析时下次重新抓取，
+// 不再被引用的页面内容由 Clear 删除
+func EvictPages(urls ...string) {
+	c := pageCache
+	if c == nil {
+		return
+	}
+	for _, url := range urls {
+		if err := os.Remove(c.entryPath(url)); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除缓存的页面 %s 失败: %v\n", url, err)
+		}
+	}
+}
+
+// FetchCached 使用 f 抓取页面并保存到缓存中。
+// 缓存中有过期的页面并且 f 支持条件请求时，先验证页面是否变化，没有变化时使用缓存的页面
+func FetchCached(ctx context.Context, f Fetcher, url string) (*Page, error) {
+	c := pageCache
+	if c == nil {
+		return f.Fetch(ctx, url)
+	}
+
+	entry, err := c.load(url)
+	if err != nil {
+		log.Printf("读取页面缓存 %s 失败: %v\n", url, err)
+	}
+	cf, ok := f.(ConditionalFetcher)
+	if entry == nil || !ok || (entry.ETag == "" && entry.LastModified == "") {
+		return c.fetch(ctx, f, url)
+	}
+
+	page, err := cf.FetchConditional(ctx, url, entry.ETag, entry.LastModified)
+	if err != nil {
+		return nil, err
+	}
+	if page.StatusCode != http.StatusNotModified {
+		c.save(ctx, page)
+		return page, nil
+	}
+
+	cached, err := c.page(entry)
+	if err != nil {
+		// 页面内容丢失时重新完整抓取
+		log.Printf("读取缓存的页面 %s 失败: %v\n", url, err)
+		return c.fetch(ctx, f, url)
+	}
+	entry.CheckedTime = time.Now().Unix()
+	if err := c.writeEntry(entry); err != nil {
+		log.Printf("更新页面缓存 %s 失败: %v\n", url, err)
+	}
+	return cached, nil
+}
+
+// fetch 完整抓取页面并保存到缓存中
+func (c *PageCache) fetch(ctx context.Context, f Fetcher, url string) (*Page, error) {
+	page, err := f.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	c.save(ctx, page)
+	return page, nil
+}
+
+// save 保存成功抓取的页面，保存失败时只记录日志
+func (c *PageCache) save(ctx context.Context, page *Page) {
+	if page.StatusCode != 0 && (page.StatusCode < 200 || page.StatusCode >= 300) {
+		return
+	}
+	if strings.TrimSpace(page.HTML) == "" {
+		return
+	}
+
+	object, err := c.writeObject([]byte(page.HTML))
+	if err != nil {
+		log.Printf("缓存页面 %s 失败: %v\n", page.URL, err)
+		return
+	}
+	now := time.Now().Unix()
+	entry := &cacheEntry{
+		URL:          page.URL,
+		FinalURL:     page.FinalURL,
+		StatusCode:   page.StatusCode,
+		ETag:         page.ETag,
+		LastModified: page.LastModified,
+		PageType:     PageType(ctx),
+		Object:       object,
+		FetchedTime:  now,
+		CheckedTime:  now,
+	}
+	if err := c.writeEntry(entry); err != nil {
+		log.Printf("缓存页面 %s 失败: %v\n", page.URL, err)
+	}
+}
+
+// expired 判断缓存的页面是否过期，没有页面类型的页面按照目录页处理
+func (c *PageCache) expired(entry *cacheEntry, now time.Time) bool {
+	pageType := entry.PageType
+	if pageType == "" {
+		pageType = PageCatalog
+	}
+	ttl := c.TTLs[pageType]
+	if ttl <= 0 {
+		return false
+	}
+	return now.Sub(time.Unix(entry.CheckedTime, 0)) > ttl
+}
+
+func (c *PageCache) indexDir() string {
+	return filepath.Join(c.Dir, "index")
+}
+
+func (c *PageCache) objectsDir() string {
+	return filepath.Join(c.Dir, "objects")
+}
+
+func (c *PageCache) entryPath(url string) string {
+	return filepath.Join(c.indexDir(), pageKey(url)+".json")
+}
+
+func (c *PageCache) objectPath(object string) string {
+	return filepath.Join(c.objectsDir(), object[:2], object)
+}
+
+// load 读取 URL 的缓存信息，没有缓存时返回 nil
+func (c *PageCache) load(url string) (*cacheEntry, error) {
+	data, err := os.ReadFile(c.entryPath(url))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if entry.URL != url || len(entry.Object) < 2 {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// page 读取缓存的页面内容
+func (c *PageCache) page(entry *cacheEntry) (*Page, error) {
+	html, err := os.ReadFile(c.objectPath(entry.Object))
+	if err != nil {
+		return nil, err
+	}
+	return &Page{
+		URL:          entry.URL,
+		FinalURL:     entry.FinalURL,
+		StatusCode:   entry.StatusCode,
+		HTML:         string(html),
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+	}, nil
+}
+
+func (c *PageCache) writeEntry(entry *cacheEntry) error {
+	if err := os.MkdirAll(c.indexDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(c.entryPath(entry.URL), data, 0644)
+}
+
+// writeObject 按照内容的哈希值保存页面内容，返回哈希值
+func (c *PageCache) writeObject(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	object := hex.EncodeToString(sum[:])
+	path := c.objectPath(object)
+	if _, err := os.Stat(path); err == nil {
+		return object, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return object, utils.WriteFileAtomic(path, data, 0644)
+}
+
+// entries 读取所有的缓存信息
+func (c *PageCache) entries() (map[string]*cacheEntry, error) {
+	files, err := os.ReadDir(c.indexDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*cacheEntry)
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(c.indexDir(), file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var entry cacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("解析页面缓存 %s 失败: %v\n", path, err)
+			continue
+		}
+		entries[path] = &entry
+	}
+	return entries, nil
+}
+
+// Clear 删除指定类型的缓存页面，pageType 为空时删除所有页面，
+// 并删除不再被引用的页面内容，返回删除的页面数
+func (c *PageCache) Clear(pageType string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	used := make(map[string]bool)
+	for path, entry := range entries {
+		if pageType == "" || entry.PageType == pageType {
+			if err := os.Remove(path); err != nil {
+				return removed, err
+			}
+			removed++
+			continue
+		}
+		used[entry.Object] = true
+	}
+
+	err = filepath.WalkDir(c.objectsDir(), func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || d.IsDir() || used[d.Name()] {
+			return err
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return removed, fmt.Errorf("删除页面内容失败: %v", err)
+	}
+	return removed, nil
+}
+
+// Stats 统计缓存的页面数、过期页面数和占用的空间
+func (c *PageCache) Stats() (*CacheStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+	stats := &CacheStats{Pages: make(map[string]int), Expired: make(map[string]int)}
+	now := time.Now()
+	for _, entry := range entries {
+		stats.Pages[entry.PageType]++
+		if c.expired(entry, now) {
+			stats.Expired[entry.PageType]++
+		}
+	}
+
+	err = filepath.WalkDir(c.objectsDir(), func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.Objects++
+		stats.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
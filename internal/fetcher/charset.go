@@ -0,0 +1,51 @@
+package fetcher
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// decodeHTML 把网页内容转换为 UTF-8。
+// 网站配置了 encoding 时直接使用，否则依次根据 BOM、Content-Type 响应头、
+// 前 1024 字节中的 <meta charset> 标签判断，都没有声明编码时，
+// 内容是合法的 UTF-8 就按 UTF-8 处理，否则按中文网站最常用的 GB18030 处理
+func decodeHTML(body []byte, contentType, override string) (string, error) {
+	var enc encoding.Encoding
+	var name string
+	if override != "" {
+		e, err := htmlindex.Get(override)
+		if err != nil {
+			return "", fmt.Errorf("未知的网页编码 %s", override)
+		}
+		enc, name = e, override
+	} else {
+		e, n, certain := charset.DetermineEncoding(body, contentType)
+		enc, name = e, n
+		if !certain && name == "windows-1252" {
+			// 没有声明编码，并且前 1024 字节不能确定是 UTF-8
+			if utf8.Valid(body) {
+				return string(body), nil
+			}
+			enc, name = simplifiedchinese.GB18030, "gb18030"
+		}
+	}
+
+	// GB18030 兼容 GBK 和 GB2312，声明为 GBK 或 GB2312 的网页中也经常出现 GBK 以外的字符
+	if enc == simplifiedchinese.GBK {
+		enc, name = simplifiedchinese.GB18030, "gb18030"
+	}
+	if enc == encoding.Nop || name == "utf-8" {
+		return string(body), nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return "", fmt.Errorf("按 %s 编码转换网页失败: %v", name, err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,42 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func TestDecodeHTML(t *testing.T) {
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String("<p>下一章</p>")
+	big5, _ := traditionalchinese.Big5.NewEncoder().String("<p>下一章</p>")
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		override    string
+	}{
+		{"UTF-8", "<p>下一章</p>", "text/html", ""},
+		{"响应头中的编码", gbk, "text/html; charset=GBK", ""},
+		{"meta 标签中的编码", `<meta charset="gb2312">` + gbk, "", ""},
+		{"没有声明编码的 GBK", gbk, "text/html", ""},
+		{"网站配置的编码优先", big5, "text/html; charset=utf-8", "big5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeHTML([]byte(tt.body), tt.contentType, tt.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "<p>下一章</p>"; !strings.HasSuffix(got, want) {
+				t.Errorf("转换结果为 %q，期望以 %q 结尾", got, want)
+			}
+		})
+	}
+
+	if _, err := decodeHTML([]byte(gbk), "", "unknown"); err == nil {
+		t.Error("未知的编码应该返回错误")
+	}
+}
@@ -0,0 +1,65 @@
+package fetcher
+
+import (
+	"context"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ChromeFetcher 使用 chromedp 抓取页面，ctx 中需要带有浏览器上下文。
+// 如果 ctx 中带有 tab 池，则从 tab 池中获取 tab，否则为每个页面创建新的 tab
+type ChromeFetcher struct{}
+
+// Fetch 在 tab 中打开页面并返回渲染后的 HTML
+func (f *ChromeFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	pool := tabPoolFromContext(ctx)
+	if pool == nil {
+		// 创建一个新的 tab
+		taskCtx, cancel := chromedp.NewContext(ctx)
+		defer cancel()
+		return navigate(taskCtx, url)
+	}
+
+	tab, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 在 tab 上执行操作，同时遵循调用方的超时和取消
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		runCtx, cancel = context.WithDeadline(tab.ctx, deadline)
+	} else {
+		runCtx, cancel = context.WithCancel(tab.ctx)
+	}
+	stop := context.AfterFunc(ctx, cancel)
+
+	page, err := navigate(runCtx, url)
+	stop()
+	cancel()
+	pool.Release(tab, err)
+	return page, err
+}
+
+// navigate 在 tab 中打开页面，等待加载完成后获取 HTML
+func navigate(ctx context.Context, url string) (*Page, error) {
+	page := &Page{URL: url}
+	resp, err := chromedp.RunResponse(ctx, chromedp.Navigate(url))
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		page.StatusCode = int(resp.Status)
+	}
+
+	err = chromedp.Run(ctx,
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		chromedp.Location(&page.FinalURL),
+		chromedp.OuterHTML("html", &page.HTML, chromedp.ByQuery),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
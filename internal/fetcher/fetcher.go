@@ -0,0 +1,75 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// 抓取方式
+const (
+	// KindChromedp 使用无头浏览器抓取，适合需要执行 JavaScript 的网站
+	KindChromedp = "chromedp"
+	// KindHTTP 使用 net/http 直接抓取，适合静态页面
+	KindHTTP = "http"
+)
+
+// Page 页面抓取结果
+type Page struct {
+	// 请求的URL
+	URL string
+	// 跳转后的最终URL
+	FinalURL string
+	// HTTP 状态码，无法获取时为 0
+	StatusCode int
+	// 页面 HTML
+	HTML string
+	// 响应头中的 ETag 和 Last-Modified，用于缓存过期后的条件请求
+	ETag         string
+	LastModified string
+}
+
+// Fetcher 页面抓取接口
+type Fetcher interface {
+	// Fetch 抓取指定URL的页面
+	Fetch(ctx context.Context, url string) (*Page, error)
+}
+
+// ConditionalFetcher 支持条件请求的 Fetcher，页面没有变化时返回状态码 304 的 Page
+type ConditionalFetcher interface {
+	Fetcher
+	// FetchConditional 带上 If-None-Match 和 If-Modified-Since 抓取页面
+	FetchConditional(ctx context.Context, url, etag, lastModified string) (*Page, error)
+}
+
+// 各抓取方式共享的实例
+var fetchers = map[string]Fetcher{
+	KindChromedp: &ChromeFetcher{},
+	KindHTTP:     NewHTTPFetcher(),
+}
+
+var fetchersMutex sync.RWMutex
+
+// Register 替换抓取方式使用的 Fetcher，返回原来的 Fetcher，
+// 用于在测试中让页面请求发送到本地的测试服务器
+func Register(kind string, f Fetcher) Fetcher {
+	fetchersMutex.Lock()
+	defer fetchersMutex.Unlock()
+	previous := fetchers[kind]
+	fetchers[kind] = f
+	return previous
+}
+
+// Get 根据抓取方式名称获取 Fetcher，名称为空时使用 chromedp
+func Get(kind string) (Fetcher, error) {
+	if kind == "" {
+		kind = KindChromedp
+	}
+	fetchersMutex.RLock()
+	f, ok := fetchers[kind]
+	fetchersMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的抓取方式: %s", kind)
+	}
+	return f, nil
+}
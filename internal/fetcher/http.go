@@ -0,0 +1,75 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/utils"
+)
+
+// HTTPFetcher 使用 net/http 抓取静态页面
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// NewHTTPFetcher 创建 HTTPFetcher
+func NewHTTPFetcher() *HTTPFetcher {
+	return &HTTPFetcher{
+		Client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Fetch 发送 GET 请求并返回响应内容
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	return f.FetchConditional(ctx, url, "", "")
+}
+
+// FetchConditional 发送带有缓存验证信息的 GET 请求，页面没有变化时返回状态码 304，HTML 为空
+func (f *HTTPFetcher) FetchConditional(ctx context.Context, url, etag, lastModified string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", utils.GetRandomUserAgent())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 网站配置中的编码优先于自动判断的编码
+	override := ""
+	if site := config.GetSiteConfig(url); site != nil {
+		override = site.Encoding
+	}
+	html, err := decodeHTML(body, resp.Header.Get("Content-Type"), override)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{
+		URL:          url,
+		FinalURL:     resp.Request.URL.String(),
+		StatusCode:   resp.StatusCode,
+		HTML:         html,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
@@ -0,0 +1,123 @@
+package fetcher
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"chromedp-scraper/internal/config"
+)
+
+// RateLimiter 单个网站的令牌桶限速器，同一网站的所有工作协程共享
+type RateLimiter struct {
+	cfg config.RateLimitConfig
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// 限制同时进行的请求数，nil 表示不限制
+	sem chan struct{}
+}
+
+// NewRateLimiter 根据配置创建限速器
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{
+		cfg:    cfg,
+		tokens: float64(max(cfg.Burst, 1)),
+		last:   time.Now(),
+	}
+	if cfg.MaxConcurrent > 0 {
+		l.sem = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	return l
+}
+
+// Wait 等待直到允许发起下一个请求，返回的 release 需要在请求结束后调用
+func (l *RateLimiter) Wait(ctx context.Context) (release func(), err error) {
+	release = func() {}
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+			release = func() { <-l.sem }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if err := sleep(ctx, l.reserve()+l.jitter()); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// reserve 预订一个令牌，返回需要等待的时间
+func (l *RateLimiter) reserve() time.Duration {
+	if l.cfg.RequestsPerSecond <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 按照经过的时间补充令牌
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.cfg.RequestsPerSecond
+	if burst := float64(max(l.cfg.Burst, 1)); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+
+	// 令牌不足时允许为负数，表示已经被预订，后来者需要等待更久
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.cfg.RequestsPerSecond * float64(time.Second))
+}
+
+// jitter 返回随机的额外延时
+func (l *RateLimiter) jitter() time.Duration {
+	lo, hi := l.cfg.JitterMinMs, l.cfg.JitterMaxMs
+	if hi <= lo {
+		return time.Duration(lo) * time.Millisecond
+	}
+	return time.Duration(lo+rand.Intn(hi-lo+1)) * time.Millisecond
+}
+
+// sleep 可被取消的等待
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	limitersMutex sync.Mutex
+	limiters      = make(map[string]*RateLimiter)
+)
+
+// LimiterFor 返回网站共享的限速器，配置变化后重新创建
+func LimiterFor(siteConfig *config.SiteConfig) *RateLimiter {
+	cfg := siteConfig.GetRateLimit()
+
+	limitersMutex.Lock()
+	defer limitersMutex.Unlock()
+
+	l, ok := limiters[siteConfig.Host]
+	if !ok || l.cfg != cfg {
+		l = NewRateLimiter(cfg)
+		limiters[siteConfig.Host] = l
+	}
+	return l
+}
@@ -0,0 +1,247 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chromedp-scraper/internal/utils"
+)
+
+// ErrNotRecorded 回放目录中没有请求的页面
+var ErrNotRecorded = errors.New("回放目录中没有这个页面")
+
+var (
+	// replaying 是否正在回放记录的页面
+	replaying bool
+	// recordDir 记录页面的目录，从缓存中读取的页面也要记录到这里
+	recordDir string
+)
+
+// recordedPage 记录的页面信息，HTML 保存在同名的 .html 文件中
+type recordedPage struct {
+	URL        string `json:"url"`
+	FinalURL   string `json:"finalUrl"`
+	StatusCode int    `json:"statusCode"`
+	// HTML 文件名
+	HTMLFile    string `json:"htmlFile"`
+	FetchedTime int64  `json:"fetchedTime"`
+}
+
+// recordedResource 记录的资源信息，资源内容保存在同名的 .bin 文件中
+type recordedResource struct {
+	URL         string `json:"url"`
+	FinalURL    string `json:"finalUrl"`
+	StatusCode  int    `json:"statusCode"`
+	ContentType string `json:"contentType"`
+	// 资源文件名
+	DataFile    string `json:"dataFile"`
+	FetchedTime int64  `json:"fetchedTime"`
+}
+
+// Recorder 使用 Next 抓取页面，并把每个页面的 URL、最终 URL、状态码和 HTML 保存到 Dir 中
+type Recorder struct {
+	Dir  string
+	Next Fetcher
+}
+
+// Fetch 抓取页面并保存，保存失败时只记录日志
+func (r *Recorder) Fetch(ctx context.Context, url string) (*Page, error) {
+	page, err := r.Next.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := savePage(r.Dir, page); err != nil {
+		log.Printf("记录页面 %s 失败: %v\n", url, err)
+	}
+	return page, nil
+}
+
+// FetchConditional Next 支持条件请求时发送条件请求，页面没有变化时不记录
+func (r *Recorder) FetchConditional(ctx context.Context, url, etag, lastModified string) (*Page, error) {
+	cf, ok := r.Next.(ConditionalFetcher)
+	if !ok {
+		return r.Fetch(ctx, url)
+	}
+	page, err := cf.FetchConditional(ctx, url, etag, lastModified)
+	if err != nil {
+		return nil, err
+	}
+	if page.StatusCode != http.StatusNotModified {
+		if err := savePage(r.Dir, page); err != nil {
+			log.Printf("记录页面 %s 失败: %v\n", url, err)
+		}
+	}
+	return page, nil
+}
+
+// Replayer 从 Dir 中读取 Recorder 保存的页面，不访问网络
+type Replayer struct {
+	Dir string
+}
+
+// Fetch 返回记录的页面，没有记录时返回 ErrNotRecorded
+func (r *Replayer) Fetch(ctx context.Context, url string) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return loadPage(r.Dir, url)
+}
+
+// EnableRecord 让所有抓取方式在抓取页面的同时把页面记录到 dir 中
+func EnableRecord(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建记录目录失败: %v", err)
+	}
+
+	fetchersMutex.Lock()
+	defer fetchersMutex.Unlock()
+	for kind, f := range fetchers {
+		fetchers[kind] = &Recorder{Dir: dir, Next: f}
+	}
+	recordDir = dir
+	log.Printf("记录抓取的页面到 %s\n", dir)
+	return nil
+}
+
+// EnableReplay 让所有抓取方式从 dir 中读取记录的页面，不再访问网络
+func EnableReplay(dir string) error {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("回放目录 %s 不存在", dir)
+	}
+
+	fetchersMutex.Lock()
+	defer fetchersMutex.Unlock()
+	for kind := range fetchers {
+		fetchers[kind] = &Replayer{Dir: dir}
+	}
+	replaying = true
+	log.Printf("从 %s 回放记录的页面\n", dir)
+	return nil
+}
+
+// Replaying 是否正在回放记录的页面，回放时不需要启动浏览器，也不需要限制访问频率
+func Replaying() bool {
+	return replaying
+}
+
+// pageKey 根据 URL 生成记录的文件名
+func pageKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:10])
+}
+
+// savePage 保存页面，先写 HTML 再写页面信息，页面信息存在时说明记录完整
+func savePage(dir string, page *Page) error {
+	key := pageKey(page.URL)
+	record := recordedPage{
+		URL:         page.URL,
+		FinalURL:    page.FinalURL,
+		StatusCode:  page.StatusCode,
+		HTMLFile:    key + ".html",
+		FetchedTime: time.Now().Unix(),
+	}
+	if err := utils.WriteFileAtomic(filepath.Join(dir, record.HTMLFile), []byte(page.HTML), 0644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "    ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(dir, key+".json"), data, 0644)
+}
+
+// loadPage 读取记录的页面
+func loadPage(dir, url string) (*Page, error) {
+	key := pageKey(url)
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, url)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record recordedPage
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("解析页面记录 %s 失败: %v", key, err)
+	}
+	if record.URL != url {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, url)
+	}
+	html, err := os.ReadFile(filepath.Join(dir, filepath.Base(record.HTMLFile)))
+	if err != nil {
+		return nil, fmt.Errorf("读取页面记录 %s 失败: %v", record.HTMLFile, err)
+	}
+	return &Page{
+		URL:        record.URL,
+		FinalURL:   record.FinalURL,
+		StatusCode: record.StatusCode,
+		HTML:       string(html),
+	}, nil
+}
+
+// resourceKey 根据资源 URL 生成记录的文件名，和页面的记录分开
+func resourceKey(url string) string {
+	return pageKey(url) + "-resource"
+}
+
+// saveResource 保存资源，和 savePage 一样先写内容再写资源信息
+func saveResource(dir string, res *Resource) error {
+	key := resourceKey(res.URL)
+	record := recordedResource{
+		URL:         res.URL,
+		FinalURL:    res.FinalURL,
+		StatusCode:  res.StatusCode,
+		ContentType: res.ContentType,
+		DataFile:    key + ".bin",
+		FetchedTime: time.Now().Unix(),
+	}
+	if err := utils.WriteFileAtomic(filepath.Join(dir, record.DataFile), res.Data, 0644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "    ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(dir, key+".json"), data, 0644)
+}
+
+// loadResource 读取记录的资源
+func loadResource(dir, url string) (*Resource, error) {
+	key := resourceKey(url)
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, url)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record recordedResource
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("解析资源记录 %s 失败: %v", key, err)
+	}
+	if record.URL != url {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, url)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, filepath.Base(record.DataFile)))
+	if err != nil {
+		return nil, fmt.Errorf("读取资源记录 %s 失败: %v", record.DataFile, err)
+	}
+	return &Resource{
+		URL:         record.URL,
+		FinalURL:    record.FinalURL,
+		StatusCode:  record.StatusCode,
+		ContentType: record.ContentType,
+		Data:        content,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"chromedp-scraper/internal/utils"
+)
+
+// maxResourceSize 单个资源（例如章节中的图片）的最大字节数
+const maxResourceSize = 20 << 20
+
+// Resource 图片等二进制资源的抓取结果
+type Resource struct {
+	// 请求的URL
+	URL string
+	// 跳转后的最终URL
+	FinalURL string
+	// HTTP 状态码
+	StatusCode int
+	// 响应头中的 Content-Type
+	ContentType string
+	// 资源内容
+	Data []byte
+}
+
+// ResourceFetcher 可以抓取图片等二进制资源的 Fetcher
+type ResourceFetcher interface {
+	// FetchResource 抓取资源，referer 为引用资源的页面，很多网站的图片需要正确的 Referer 才能访问
+	FetchResource(ctx context.Context, url, referer string) (*Resource, error)
+}
+
+// GetResource 根据抓取方式名称获取抓取资源的 ResourceFetcher，
+// 浏览器抓取方式不能直接抓取资源，改用 http 抓取方式
+func GetResource(kind string) (ResourceFetcher, error) {
+	f, err := Get(kind)
+	if err != nil {
+		return nil, err
+	}
+	if rf, ok := f.(ResourceFetcher); ok {
+		return rf, nil
+	}
+	if f, err = Get(KindHTTP); err != nil {
+		return nil, err
+	}
+	if rf, ok := f.(ResourceFetcher); ok {
+		return rf, nil
+	}
+	return nil, fmt.Errorf("抓取方式 %s 不支持下载图片", kind)
+}
+
+// FetchResource 发送 GET 请求并返回原始的响应内容，不转换编码
+func (f *HTTPFetcher) FetchResource(ctx context.Context, url, referer string) (*Resource, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", utils.GetRandomUserAgent())
+	req.Header.Set("Accept", "image/avif,image/webp,image/*,*/*;q=0.8")
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResourceSize {
+		return nil, fmt.Errorf("资源超过 %d MB", maxResourceSize>>20)
+	}
+
+	return &Resource{
+		URL:         url,
+		FinalURL:    resp.Request.URL.String(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Data:        data,
+	}, nil
+}
+
+// FetchResource 抓取资源并保存到 Dir 中，Next 是浏览器抓取方式时和 GetResource 一样改用 http 抓取方式，
+// 保存失败时只记录日志
+func (r *Recorder) FetchResource(ctx context.Context, url, referer string) (*Resource, error) {
+	rf, ok := r.Next.(ResourceFetcher)
+	if !ok {
+		f, err := Get(KindHTTP)
+		if err != nil {
+			return nil, err
+		}
+		// 记录时 http 抓取方式也被 Recorder 包装，直接使用里面的 Fetcher，资源只记录一次
+		if recorder, isRecorder := f.(*Recorder); isRecorder {
+			f = recorder.Next
+		}
+		if rf, ok = f.(ResourceFetcher); !ok {
+			return nil, fmt.Errorf("抓取方式不支持下载图片")
+		}
+	}
+	res, err := rf.FetchResource(ctx, url, referer)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveResource(r.Dir, res); err != nil {
+		log.Printf("记录资源 %s 失败: %v\n", url, err)
+	}
+	return res, nil
+}
+
+// FetchResource 返回记录的资源，没有记录时返回 ErrNotRecorded
+func (r *Replayer) FetchResource(ctx context.Context, url, referer string) (*Resource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return loadResource(r.Dir, url)
+}
@@ -0,0 +1,57 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pageOnlyFetcher 和浏览器抓取方式一样只能抓取页面，不能抓取资源
+type pageOnlyFetcher struct{}
+
+func (pageOnlyFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	return nil, fmt.Errorf("不应该抓取页面 %s", url)
+}
+
+func TestRecorderFetchResource(t *testing.T) {
+	image := []byte("\x89PNG\r\n\x1a\n测试图片")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(image)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		next Fetcher
+	}{
+		{"浏览器抓取方式改用 http 抓取方式", pageOnlyFetcher{}},
+		{"http 抓取方式", NewHTTPFetcher()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			recorder := &Recorder{Dir: dir, Next: tt.next}
+			url := srv.URL + "/1.png"
+
+			res, err := recorder.FetchResource(context.Background(), url, srv.URL)
+			if err != nil {
+				t.Fatalf("抓取资源失败: %v", err)
+			}
+			if !bytes.Equal(res.Data, image) || res.ContentType != "image/png" {
+				t.Errorf("抓取到 %q (%s)，期望 %q (image/png)", res.Data, res.ContentType, image)
+			}
+
+			replayed, err := (&Replayer{Dir: dir}).FetchResource(context.Background(), url, srv.URL)
+			if err != nil {
+				t.Fatalf("回放资源失败: %v", err)
+			}
+			if !bytes.Equal(replayed.Data, image) || replayed.ContentType != "image/png" {
+				t.Errorf("回放得到 %q (%s)，期望 %q (image/png)", replayed.Data, replayed.ContentType, image)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ErrTabPoolClosed tab 池已关闭
+var ErrTabPoolClosed = errors.New("tab 池已关闭")
+
+// DefaultTabMaxUses 每个 tab 默认最多导航的次数，超过后重新创建
+const DefaultTabMaxUses = 50
+
+// Tab 浏览器 tab，可以在多个章节之间复用
+type Tab struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// 已经导航的次数
+	uses int
+}
+
+// TabPool 浏览器 tab 池，限制同时打开的 tab 数量并复用 tab
+type TabPool struct {
+	browserCtx context.Context
+	// 每个 tab 最多导航的次数
+	maxUses int
+	// 空闲的 tab 槽位，nil 表示槽位中还没有创建 tab
+	slots chan *Tab
+
+	mu     sync.Mutex
+	closed bool
+	stop   func() bool
+}
+
+// NewTabPool 在浏览器上下文中创建最多 size 个 tab 的 tab 池，
+// 每个 tab 导航 maxUses 次后重新创建，browserCtx 取消时 tab 池自动关闭
+func NewTabPool(browserCtx context.Context, size, maxUses int) *TabPool {
+	if size < 1 {
+		size = 1
+	}
+	if maxUses < 1 {
+		maxUses = DefaultTabMaxUses
+	}
+	p := &TabPool{
+		browserCtx: browserCtx,
+		maxUses:    maxUses,
+		slots:      make(chan *Tab, size),
+	}
+	for i := 0; i < size; i++ {
+		p.slots <- nil
+	}
+	p.stop = context.AfterFunc(browserCtx, p.Close)
+	return p
+}
+
+// Acquire 获取一个空闲的 tab，没有空闲 tab 时等待
+func (p *TabPool) Acquire(ctx context.Context) (*Tab, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case t := <-p.slots:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.closed {
+			if t != nil {
+				t.cancel()
+			}
+			return nil, ErrTabPoolClosed
+		}
+		if t == nil {
+			// 槽位中还没有 tab，创建一个新的
+			tabCtx, cancel := chromedp.NewContext(p.browserCtx)
+			t = &Tab{ctx: tabCtx, cancel: cancel}
+		}
+		t.uses++
+		return t, nil
+	}
+}
+
+// Release 归还 tab，如果使用中出现错误或者达到最大导航次数，关闭该 tab
+func (p *TabPool) Release(t *Tab, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		t.cancel()
+		return
+	}
+	if err != nil || t.uses >= p.maxUses {
+		if err != nil {
+			log.Printf("tab 出现错误，重新创建: %v\n", err)
+		}
+		t.cancel()
+		t = nil
+	}
+	p.slots <- t
+}
+
+// Close 关闭 tab 池和所有空闲的 tab，正在使用的 tab 在归还时关闭
+func (p *TabPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	p.stop()
+
+	for {
+		select {
+		case t := <-p.slots:
+			if t != nil {
+				t.cancel()
+			}
+		default:
+			// 唤醒等待中的 Acquire
+			close(p.slots)
+			return
+		}
+	}
+}
+
+type tabPoolKey struct{}
+
+// WithTabPool 将 tab 池附加到上下文中，ChromeFetcher 会从中获取 tab
+func WithTabPool(ctx context.Context, pool *TabPool) context.Context {
+	return context.WithValue(ctx, tabPoolKey{}, pool)
+}
+
+// tabPoolFromContext 从上下文中获取 tab 池
+func tabPoolFromContext(ctx context.Context) *TabPool {
+	pool, _ := ctx.Value(tabPoolKey{}).(*TabPool)
+	return pool
+}
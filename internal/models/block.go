@@ -0,0 +1,57 @@
+package models
+
+import "strings"
+
+// BlockType 章节正文中内容块的类型
+type BlockType string
+
+const (
+	// BlockParagraph 正文段落
+	BlockParagraph BlockType = "paragraph"
+	// BlockHeading 正文中的小标题
+	BlockHeading BlockType = "heading"
+	// BlockImage 插图
+	BlockImage BlockType = "image"
+	// BlockAuthorNote 作者的话，例如"作者有话要说"
+	BlockAuthorNote BlockType = "authorNote"
+	// BlockSeparator 分隔线，例如 *** 或 <hr>
+	BlockSeparator BlockType = "separator"
+)
+
+// Block 章节正文中的一个内容块，章节正文由按顺序排列的内容块组成
+type Block struct {
+	Type BlockType `json:"type"`
+	// 文本内容，图片为空
+	Text string `json:"text,omitempty"`
+	// 图片链接
+	Src string `json:"src,omitempty"`
+	// 图片的替代文本
+	Alt string `json:"alt,omitempty"`
+	// 下载到工作目录 images/ 下的图片文件名，由图片内容的 SHA-256 和扩展名组成，没有下载时为空
+	File string `json:"file,omitempty"`
+}
+
+// BlocksText 把内容块转换为纯文本正文，内容块之间以空行分隔，图片不出现在纯文本中
+func BlocksText(blocks []Block) string {
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == BlockImage {
+			continue
+		}
+		if text := strings.TrimSpace(block.Text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// TextBlocks 把没有结构信息的纯文本正文按行拆分为段落，用于读取旧版本保存的章节
+func TextBlocks(content string) []Block {
+	var blocks []Block
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			blocks = append(blocks, Block{Type: BlockParagraph, Text: line})
+		}
+	}
+	return blocks
+}
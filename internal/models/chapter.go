@@ -2,15 +2,19 @@ package models
 
 // Novel 结构体用于存储小说信息
 type Novel struct {
-	Title    string
-	Author   string
-	Chapters []*Chapter
+	Title     string
+	Author    string
+	SourceURL string // 小说来源链接（目录页或第一章）
+	Chapters  []*Chapter
 }
 
 // Chapter 结构体用于存储小说章节信息
 type Chapter struct {
-	Title    string
-	Content  string
+	Title string
+	// 纯文本正文，由 Blocks 生成，保存为 TXT
+	Content string
+	// 按顺序排列的正文内容块，旧版本保存的章节没有内容块
+	Blocks   []Block
 	NextLink string
 }
 
@@ -25,5 +29,6 @@ type ChapterInfo struct {
 // Catalog 结构体用于存储目录信息
 type Catalog struct {
 	Title    string //整部小说的标题
+	Author   string //作者
 	Chapters []ChapterInfo
 }
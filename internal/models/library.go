@@ -0,0 +1,77 @@
+package models
+
+// 导出格式
+const (
+	FormatTXT      = "txt"
+	FormatEPUB     = "epub"
+	FormatHTML     = "html"
+	FormatMarkdown = "md"
+)
+
+// LibraryEntry 书库中跟踪的一本小说
+type LibraryEntry struct {
+	// 小说标识，同时也是工作目录名
+	ID string `json:"id"`
+	// 小说标题，第一次爬取之后才能确定
+	Title string `json:"title,omitempty"`
+	// 目录页链接，顺序爬取时为起始章节链接
+	URL string `json:"url"`
+	// 爬取模式：catalog 或 follow
+	Mode string `json:"mode"`
+	// 导出格式：txt、epub、html、md
+	Formats []string `json:"formats"`
+	// 加入书库的时间
+	AddedTime int64 `json:"addedTime"`
+	// 最后检查更新的时间
+	LastCheckedTime int64 `json:"lastCheckedTime"`
+	// 最后检查时已经爬取的章节数
+	LastChapterCount int `json:"lastChapterCount"`
+	// 最后一次更新的错误信息
+	LastError string `json:"lastError,omitempty"`
+	// 后台模式下检查更新的间隔，例如 "6h"，为空时使用默认间隔
+	CheckInterval string `json:"checkInterval,omitempty"`
+	// 后台模式下一次检查更新的时间
+	NextCheckTime int64 `json:"nextCheckTime,omitempty"`
+	// 连续没有新章节的检查次数，用于延长检查间隔
+	IdleChecks int `json:"idleChecks,omitempty"`
+}
+
+// HasFormat 检查是否需要导出指定格式
+func (e *LibraryEntry) HasFormat(format string) bool {
+	for _, f := range e.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Library 跟踪的小说列表
+type Library struct {
+	Novels []*LibraryEntry `json:"novels"`
+}
+
+// Find 根据小说标识、标题或链接查找小说，不存在时返回 nil
+func (l *Library) Find(key string) *LibraryEntry {
+	for _, entry := range l.Novels {
+		if entry.ID == key || entry.URL == key || (entry.Title != "" && entry.Title == key) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Remove 根据小说标识、标题或链接从书库中移除小说，返回被移除的小说
+func (l *Library) Remove(key string) *LibraryEntry {
+	entry := l.Find(key)
+	if entry == nil {
+		return nil
+	}
+	for i, e := range l.Novels {
+		if e == entry {
+			l.Novels = append(l.Novels[:i], l.Novels[i+1:]...)
+			break
+		}
+	}
+	return entry
+}
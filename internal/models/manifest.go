@@ -0,0 +1,126 @@
+package models
+
+// ChapterStatus 章节爬取状态
+type ChapterStatus string
+
+const (
+	// ChapterPending 等待爬取
+	ChapterPending ChapterStatus = "pending"
+	// ChapterDone 已爬取并保存
+	ChapterDone ChapterStatus = "done"
+	// ChapterFailed 爬取或保存失败
+	ChapterFailed ChapterStatus = "failed"
+	// ChapterSkipped 不在本次爬取范围内
+	ChapterSkipped ChapterStatus = "skipped"
+)
+
+// 爬取模式
+const (
+	// ModeCatalog 根据目录页爬取
+	ModeCatalog = "catalog"
+	// ModeFollow 沿着下一章链接顺序爬取
+	ModeFollow = "follow"
+)
+
+// ChapterRecord 单个章节的爬取记录
+type ChapterRecord struct {
+	// 章节序号
+	Index int `json:"index"`
+	// 章节标题
+	Title string `json:"title"`
+	// 章节链接
+	URL string `json:"url"`
+	// 下一章链接，顺序爬取时用于继续爬取
+	NextURL string `json:"nextUrl,omitempty"`
+	// 爬取状态
+	Status ChapterStatus `json:"status"`
+	// 尝试爬取的次数
+	Attempts int `json:"attempts"`
+	// 最后一次错误信息
+	LastError string `json:"lastError,omitempty"`
+	// 章节内容的 SHA-256
+	ContentHash string `json:"contentHash,omitempty"`
+	// 章节内容的字节数
+	ByteLength int `json:"byteLength"`
+	// 最后更新时间
+	UpdatedTime int64 `json:"updatedTime"`
+}
+
+// Manifest 小说的章节清单，记录每个章节的爬取状态
+type Manifest struct {
+	// 小说标题
+	Title string `json:"title"`
+	// 爬取模式：catalog 或 follow
+	Mode string `json:"mode"`
+	// 已按顺序合并到的章节序号
+	MergedChapterNum int `json:"mergedChapter"`
+	// 合并文件中已经确认写入完成的字节数，0 表示未知
+	MergedBytes int64 `json:"mergedBytes"`
+	// 是否已完成
+	IsCompleted bool `json:"isCompleted"`
+	// 最后更新时间
+	LastUpdateTime int64 `json:"lastUpdateTime"`
+	// 章节记录，按章节序号排序
+	Chapters []*ChapterRecord `json:"chapters"`
+}
+
+// Chapter 返回指定序号的章节记录，不存在时返回 nil
+func (m *Manifest) Chapter(index int) *ChapterRecord {
+	for _, record := range m.Chapters {
+		if record.Index == index {
+			return record
+		}
+	}
+	return nil
+}
+
+// LastDone 返回序号最大的已完成章节，没有时返回 nil
+func (m *Manifest) LastDone() *ChapterRecord {
+	var last *ChapterRecord
+	for _, record := range m.Chapters {
+		if record.Status == ChapterDone && (last == nil || record.Index > last.Index) {
+			last = record
+		}
+	}
+	return last
+}
+
+// FirstIndex 返回爬取范围内序号最小的章节，即合并文件的第一个章节，没有时返回 0
+func (m *Manifest) FirstIndex() int {
+	for _, record := range m.Chapters {
+		if record.Status != ChapterSkipped {
+			return record.Index
+		}
+	}
+	return 0
+}
+
+// Count 返回指定状态的章节数
+func (m *Manifest) Count(status ChapterStatus) int {
+	count := 0
+	for _, record := range m.Chapters {
+		if record.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Record 返回指定序号的章节记录，不存在时按序号插入一条等待爬取的记录
+func (m *Manifest) Record(index int) *ChapterRecord {
+	pos := len(m.Chapters)
+	for i, record := range m.Chapters {
+		if record.Index == index {
+			return record
+		}
+		if record.Index > index {
+			pos = i
+			break
+		}
+	}
+	record := &ChapterRecord{Index: index, Status: ChapterPending}
+	m.Chapters = append(m.Chapters, nil)
+	copy(m.Chapters[pos+1:], m.Chapters[pos:])
+	m.Chapters[pos] = record
+	return record
+}
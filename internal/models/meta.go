@@ -0,0 +1,27 @@
+package models
+
+// NovelMeta 小说元数据，保存在小说工作目录中
+type NovelMeta struct {
+	// 小说标识，由网站域名和小说ID组成
+	ID string `json:"id"`
+	// 小说标题
+	Title string `json:"title"`
+	// 作者
+	Author string `json:"author"`
+	// 来源链接（目录页或第一章）
+	SourceURL string `json:"sourceUrl"`
+	// 创建时间
+	CreatedTime int64 `json:"createdTime"`
+	// 最后更新时间
+	LastUpdateTime int64 `json:"lastUpdateTime"`
+}
+
+// ReadingPosition 阅读进度，保存在小说工作目录中
+type ReadingPosition struct {
+	// 正在阅读的章节序号
+	Chapter int `json:"chapter"`
+	// 章节内已经阅读的比例，0 到 1
+	Offset float64 `json:"offset"`
+	// 最后更新时间
+	UpdatedTime int64 `json:"updatedTime"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// WatermarkRule 从多个章节中反复出现的行学习到的水印规则，经过用户确认后保存，
+// 只对发现规则的网站生效，整行匹配时删除
+type WatermarkRule struct {
+	// 需要删除的行
+	Text string `json:"text,omitempty"`
+	// 行中的数字各不相同时，使用正则表达式匹配整行
+	Pattern string `json:"pattern,omitempty"`
+	// 规则所属网站配置的 host
+	Host string `json:"host,omitempty"`
+	// 发现规则的小说标识
+	Source string `json:"source,omitempty"`
+	// 加入规则的时间
+	AddedTime int64 `json:"addedTime"`
+}
+
+// Key 返回规则所属的网站和匹配内容，用于判断规则是否重复
+func (r *WatermarkRule) Key() string {
+	if r.Pattern != "" {
+		return r.Host + "|pattern:" + r.Pattern
+	}
+	return r.Host + "|text:" + r.Text
+}
+
+// Watermarks 学习到的水印规则
+type Watermarks struct {
+	Rules []*WatermarkRule `json:"rules"`
+}
+
+// ForHost 返回属于指定网站的规则
+func (w *Watermarks) ForHost(host string) []*WatermarkRule {
+	var rules []*WatermarkRule
+	for _, rule := range w.Rules {
+		if rule.Host == host {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,134 @@
+package scraper
+
+import (
+	"regexp"
+	"strings"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// authorNoteMarkers 作者的话的开头，这一段和之后的段落都是作者的话
+var authorNoteMarkers = []string{"作者有话要说", "作者有话说"}
+
+// separatorPattern 匹配只由分隔符号组成的行，例如 ***、———、◇◇◇
+var separatorPattern = regexp.MustCompile(`^[*＊\-－=＝~～#＃·•◇◆☆★○●※_—\s]{3,}$`)
+
+// contentBlocks 按顺序提取正文元素中的段落、小标题、分隔线、图片和作者的话，跳过分页提示，
+// 只处理正文元素的直接子节点，其他元素（例如 <div>、<a>、<center>）只提取其中的图片
+func contentBlocks(contentEl *goquery.Selection, baseURL string, siteConfig *config.SiteConfig) []models.Block {
+	var blocks []models.Block
+	add := func(blockType models.BlockType, text string) {
+		if text = strings.TrimSpace(text); text != "" && !isPageMarker(text, siteConfig) {
+			if blockType == models.BlockParagraph && separatorPattern.MatchString(text) {
+				blockType = models.BlockSeparator
+			}
+			blocks = append(blocks, models.Block{Type: blockType, Text: text})
+		}
+	}
+	addImages := func(s *goquery.Selection) {
+		s.Find("img").AddSelection(s.Filter("img")).Each(func(i int, img *goquery.Selection) {
+			if src := imageSource(img); src != "" {
+				alt, _ := img.Attr("alt")
+				blocks = append(blocks, models.Block{
+					Type: models.BlockImage,
+					Src:  utils.MakeAbsoluteURL(src, baseURL),
+					Alt:  strings.TrimSpace(alt),
+				})
+			}
+		})
+	}
+
+	contentEl.Contents().Each(func(i int, s *goquery.Selection) {
+		switch {
+		case goquery.NodeName(s) == "#text":
+			add(models.BlockParagraph, s.Text())
+		case isAuthorNoteElement(s, siteConfig):
+			for _, text := range elementParagraphs(s) {
+				add(models.BlockAuthorNote, text)
+			}
+		case s.Is("p"):
+			addImages(s)
+			add(models.BlockParagraph, s.Text())
+		case s.Is("h1,h2,h3,h4,h5,h6"):
+			add(models.BlockHeading, s.Text())
+		case s.Is("hr"):
+			blocks = append(blocks, models.Block{Type: models.BlockSeparator, Text: "***"})
+		default:
+			// 图片经常放在 <div>、<a>、<figure> 等元素中，按文档顺序提取
+			addImages(s)
+		}
+	})
+	return blocks
+}
+
+// imageSource 返回图片的链接，延迟加载的图片链接通常在 data-src 或 data-original 中
+func imageSource(img *goquery.Selection) string {
+	for _, attr := range []string{"data-src", "data-original", "src"} {
+		if src, ok := img.Attr(attr); ok && strings.TrimSpace(src) != "" && !strings.HasPrefix(src, "data:") {
+			return strings.TrimSpace(src)
+		}
+	}
+	return ""
+}
+
+// isAuthorNoteElement 判断元素是否匹配网站配置中作者的话的选择器
+func isAuthorNoteElement(s *goquery.Selection, siteConfig *config.SiteConfig) bool {
+	for _, selector := range siteConfig.AuthorNoteSelectors {
+		if s.Is(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// elementParagraphs 返回元素中每个段落的文本，没有 <p> 时按行拆分
+func elementParagraphs(s *goquery.Selection) []string {
+	var paragraphs []string
+	if p := s.Find("p"); p.Length() > 0 {
+		p.Each(func(i int, p *goquery.Selection) {
+			paragraphs = append(paragraphs, p.Text())
+		})
+		return paragraphs
+	}
+	return strings.Split(s.Text(), "\n")
+}
+
+// markAuthorNotes 把以"作者有话要说"开头的段落和之后的所有段落标记为作者的话
+func markAuthorNotes(blocks []models.Block) []models.Block {
+	inNote := false
+	for i := range blocks {
+		if blocks[i].Type != models.BlockParagraph && blocks[i].Type != models.BlockAuthorNote {
+			continue
+		}
+		if !inNote {
+			for _, marker := range authorNoteMarkers {
+				if strings.HasPrefix(blocks[i].Text, marker) {
+					inNote = true
+					break
+				}
+			}
+		}
+		if inNote {
+			blocks[i].Type = models.BlockAuthorNote
+		}
+	}
+	return blocks
+}
+
+// cleanBlocks 对每个有文本的内容块执行 clean，清理后没有文本的内容块会被删除
+func cleanBlocks(blocks []models.Block, clean func(string) string) []models.Block {
+	kept := blocks[:0]
+	for _, block := range blocks {
+		if block.Type != models.BlockImage {
+			if block.Text = clean(block.Text); block.Text == "" {
+				continue
+			}
+		}
+		kept = append(kept, block)
+	}
+	return kept
+}
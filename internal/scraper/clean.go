@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"chromedp-scraper/internal/config"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// removeElements 提取正文前删除正文元素中清理规则指定的元素，
+// 只在正文元素内查找，不会影响下一章链接的查找
+func removeElements(contentEl *goquery.Selection, clean config.CleanConfig) {
+	for _, selector := range clean.RemoveSelectors {
+		contentEl.Find(selector).Remove()
+	}
+}
+
+// CleanContent 按照清理规则清理章节正文：全角字母数字转为半角、删除匹配的行、正则替换、合并连续的空行
+func CleanContent(content string, clean config.CleanConfig) string {
+	return newContentCleaner(clean).clean(content)
+}
+
+// contentCleaner 编译好正则表达式的清理规则，逐个清理章节的内容块时不需要重复编译
+type contentCleaner struct {
+	config       config.CleanConfig
+	linePatterns []*regexp.Regexp
+	replacements []*regexp.Regexp
+}
+
+// newContentCleaner 编译清理规则中的正则表达式，无效的规则会被跳过
+func newContentCleaner(clean config.CleanConfig) *contentCleaner {
+	c := &contentCleaner{config: clean}
+	for _, pattern := range clean.RemoveLinePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("清理规则 %s 无效: %v\n", pattern, err)
+			continue
+		}
+		c.linePatterns = append(c.linePatterns, re)
+	}
+	for _, r := range clean.Replacements {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			log.Printf("清理规则 %s 无效: %v\n", r.Pattern, err)
+			// 保留占位，和 Replacements 一一对应
+		}
+		c.replacements = append(c.replacements, re)
+	}
+	return c
+}
+
+func (c *contentCleaner) clean(content string) string {
+	if c.config.NormalizeWidth {
+		content = normalizeWidth(content)
+	}
+
+	if len(c.config.RemoveLines) > 0 || len(c.linePatterns) > 0 {
+		lines := strings.Split(content, "\n")
+		kept := lines[:0]
+		for _, line := range lines {
+			if !isRemovedLine(strings.TrimSpace(line), c.config.RemoveLines, c.linePatterns) {
+				kept = append(kept, line)
+			}
+		}
+		content = strings.Join(kept, "\n")
+	}
+
+	for i, re := range c.replacements {
+		if re != nil {
+			content = re.ReplaceAllString(content, c.config.Replacements[i].Replace)
+		}
+	}
+
+	if c.config.CollapseBlankLines {
+		content = collapseBlankLines(content)
+	}
+	return strings.TrimSpace(content)
+}
+
+// isRemovedLine 判断一行是否需要删除，空行由 collapseBlankLines 处理
+func isRemovedLine(line string, texts []string, patterns []*regexp.Regexp) bool {
+	if line == "" {
+		return false
+	}
+	for _, text := range texts {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	for _, re := range patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeWidth 把全角的字母、数字和网址中常见的符号转为半角，
+// 中文标点（例如"，"和"："）保持不变
+func normalizeWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'Ａ' && r <= 'Ｚ', r >= 'ａ' && r <= 'ｚ', r >= '０' && r <= '９',
+			r == '．', r == '／', r == '＠', r == '＿':
+			// 全角字符与对应的半角字符相差 0xFEE0
+			return r - 0xFEE0
+		}
+		return r
+	}, s)
+}
+
+// collapseBlankLines 把连续的空行合并为一个，只包含空白字符的行视为空行
+func collapseBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	kept := lines[:0]
+	blank := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			if !blank {
+				kept = append(kept, "")
+			}
+			blank = true
+			continue
+		}
+		kept = append(kept, line)
+		blank = false
+	}
+	return strings.Join(kept, "\n")
+}
@@ -28,6 +28,8 @@ const (
 	ErrorTypeNoConfig
 	// ErrorTypeNoContent 未找到内容（不可重试）
 	ErrorTypeNoContent
+	// ErrorTypeBadStatus 服务器返回错误状态码（不可重试）
+	ErrorTypeBadStatus
 )
 
 // Error 实现 error 接口
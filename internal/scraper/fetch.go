@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/fetcher"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// fetchTimeout 单个页面的抓取超时时间
+var fetchTimeout = 60 * time.Second
+
+// fetchDocument 使用网站配置的抓取方式加载页面，并解析为 goquery 文档
+func fetchDocument(ctx context.Context, u string, siteConfig *config.SiteConfig) (*fetcher.Page, *goquery.Document, error) {
+	f, err := fetcher.Get(siteConfig.Fetcher)
+	if err != nil {
+		return nil, nil, NewScrapeError(ErrorTypeNoConfig, "网站配置错误", err)
+	}
+
+	// 缓存中有没有过期的页面时直接使用
+	if page := fetcher.CachedPage(ctx, u); page != nil {
+		return parsePage(page, u)
+	}
+
+	// 按照网站的访问频率限制等待，回放记录的页面时不需要等待
+	if !fetcher.Replaying() {
+		release, err := fetcher.LimiterFor(siteConfig).Wait(ctx)
+		if err != nil {
+			return nil, nil, NewScrapeError(ErrorTypeLoadFailed, "等待访问频率限制失败", err)
+		}
+		defer release()
+	}
+
+	// 为整个抓取过程创建一个超时上下文
+	timeoutCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	page, err := fetcher.FetchCached(timeoutCtx, f, u)
+	if errors.Is(err, fetcher.ErrNotRecorded) {
+		return nil, nil, NewScrapeError(ErrorTypeNoContent, "页面加载失败", err)
+	}
+	if err != nil {
+		// 检查是否为超时错误
+		if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "deadline exceeded") {
+			return nil, nil, NewScrapeError(ErrorTypeTimeout, "页面加载超时", err)
+		}
+		return nil, nil, NewScrapeError(ErrorTypeLoadFailed, "页面加载失败", err)
+	}
+
+	// 检查状态码，429 和 5xx 可以重试
+	if page.StatusCode >= 400 {
+		message := fmt.Sprintf("服务器返回状态码 %d", page.StatusCode)
+		if page.StatusCode == http.StatusTooManyRequests || page.StatusCode >= 500 {
+			return nil, nil, NewScrapeError(ErrorTypeLoadFailed, message, nil)
+		}
+		return nil, nil, NewScrapeError(ErrorTypeBadStatus, message, nil)
+	}
+	return parsePage(page, u)
+}
+
+// parsePage 将页面 HTML 解析为 goquery 文档
+func parsePage(page *fetcher.Page, u string) (*fetcher.Page, *goquery.Document, error) {
+	if page.FinalURL == "" {
+		page.FinalURL = u
+	}
+
+	// 使用 goquery 解析 HTML
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page.HTML))
+	if err != nil {
+		return nil, nil, NewScrapeError(ErrorTypeParseError, "解析HTML失败", err)
+	}
+	return page, doc, nil
+}
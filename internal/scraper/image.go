@@ -0,0 +1,61 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/fetcher"
+)
+
+// imageExtensions 支持下载的图片格式，EPUB 阅读器都能显示这些格式
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// FetchImage 下载章节中的图片，使用章节所在网站的抓取方式和访问频率限制，
+// 章节页面作为 Referer。返回图片内容和扩展名，图片格式根据内容判断
+func FetchImage(ctx context.Context, imageURL, chapterURL string) ([]byte, string, error) {
+	siteConfig := config.GetSiteConfig(chapterURL)
+	if siteConfig == nil {
+		return nil, "", NewScrapeError(ErrorTypeNoConfig, "未找到网站配置", nil)
+	}
+	rf, err := fetcher.GetResource(siteConfig.Fetcher)
+	if err != nil {
+		return nil, "", NewScrapeError(ErrorTypeNoConfig, "网站配置错误", err)
+	}
+
+	// 回放时从记录的目录中读取图片，不需要等待访问频率限制
+	if !fetcher.Replaying() {
+		release, err := fetcher.LimiterFor(siteConfig).Wait(ctx)
+		if err != nil {
+			return nil, "", NewScrapeError(ErrorTypeLoadFailed, "等待访问频率限制失败", err)
+		}
+		defer release()
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	resource, err := rf.FetchResource(timeoutCtx, imageURL, chapterURL)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, "", NewScrapeError(ErrorTypeTimeout, "图片下载超时", err)
+		}
+		return nil, "", NewScrapeError(ErrorTypeLoadFailed, "图片下载失败", err)
+	}
+	if resource.StatusCode >= 400 {
+		return nil, "", NewScrapeError(ErrorTypeBadStatus, fmt.Sprintf("服务器返回状态码 %d", resource.StatusCode), nil)
+	}
+
+	// 很多网站的图片响应头不准确，防盗链时还会返回 HTML 页面，以内容为准
+	ext, ok := imageExtensions[http.DetectContentType(resource.Data)]
+	if !ok {
+		return nil, "", NewScrapeError(ErrorTypeParseError, fmt.Sprintf("不支持的图片格式: %s", resource.ContentType), nil)
+	}
+	return resource.Data, ext, nil
+}
@@ -0,0 +1,37 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFetchImage 图片格式根据内容判断，不是图片的页面返回错误
+func TestFetchImage(t *testing.T) {
+	loadSiteConfigs(t)
+	startFixtureServer(t)
+	ctx := context.Background()
+	chapterURL := "http://www.drxsw.com/book/2002/3.html"
+
+	// 测试服务器返回的 Content-Type 是 text/html，文件扩展名也和内容不一致
+	data, ext, err := FetchImage(ctx, "http://www.drxsw.com/files/2002/map.jpg", chapterURL)
+	if err != nil {
+		t.Fatalf("FetchImage 失败: %v", err)
+	}
+	want, err := os.ReadFile(filepath.Join(fixturesDir, "drxsw.com", "pages", "files", "2002", "map.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext != ".png" || !bytes.Equal(data, want) {
+		t.Errorf("FetchImage 返回 %d 字节 %s，期望 %d 字节 .png", len(data), ext, len(want))
+	}
+
+	if _, _, err := FetchImage(ctx, chapterURL, chapterURL); err == nil {
+		t.Error("下载 HTML 页面应该返回错误")
+	}
+	if _, _, err := FetchImage(ctx, "http://www.drxsw.com/files/2002/missing.jpg", chapterURL); err == nil {
+		t.Error("不存在的图片应该返回错误")
+	}
+}
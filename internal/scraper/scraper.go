@@ -4,18 +4,22 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"regexp"
 	"strings"
 	"time"
 
 	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/fetcher"
 	"chromedp-scraper/internal/models"
 	"chromedp-scraper/internal/utils"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/chromedp/chromedp"
 )
 
-// ScrapeCatalog 爬取小说目录页面
+// maxCatalogPages 目录最多翻页的次数，防止翻页链接循环
+const maxCatalogPages = 500
+
+// ScrapeCatalog 爬取小说目录页面，如果目录分为多页，则依次爬取所有目录页
 func ScrapeCatalog(ctx context.Context, u string) (*models.Catalog, error) {
 	// 获取网站配置
 	siteConfig := config.GetSiteConfig(u)
@@ -23,77 +27,153 @@ func ScrapeCatalog(ctx context.Context, u string) (*models.Catalog, error) {
 		return nil, NewScrapeError(ErrorTypeNoConfig, "未找到网站配置", nil)
 	}
 
-	var html string
-	timeS := time.Now() // 记录开始时间
-
-	// 加载页面
-	if err := chromedp.Run(ctx,
-		chromedp.Navigate(u),
-		chromedp.OuterHTML("html", &html),
-	); err != nil {
-		if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "deadline exceeded") {
-			return nil, NewScrapeError(ErrorTypeTimeout, "页面加载超时", err)
-		}
-		return nil, NewScrapeError(ErrorTypeLoadFailed, "页面加载失败", err)
-	}
-
-	// 解析HTML
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
-	if err != nil {
-		return nil, NewScrapeError(ErrorTypeParseError, "解析HTML失败", err)
-	}
-
-	log.Println("目录页面加载解析完成,耗时:", time.Since(timeS).Seconds(), "秒")
+	// 目录页会随着新章节发布而变化，使用较短的缓存有效期
+	ctx = fetcher.WithPageType(ctx, fetcher.PageCatalog)
 
 	// 创建目录对象
 	catalog := &models.Catalog{}
-	// 获取章节标题
-	log.Println("正在获取标题...")
-	for _, selector := range siteConfig.NovelTitleSelectors {
-		if title := doc.Find(selector).First().Text(); title != "" {
-			catalog.Title = strings.TrimSpace(title)
-			break
-		}
-	}
-	catalog.Title = strings.TrimSpace(catalog.Title)
-
-	// 获取章节列表
 	chapters := make([]models.ChapterInfo, 0)
-	log.Println("正在获取章节列表...")
-	for _, selector := range siteConfig.ChapterListSelectors {
-		doc.Find(selector).Find("a").Each(func(i int, s *goquery.Selection) {
-			href, exists := s.Attr("href")
-			if !exists {
-				return
-			}
+	seenChapters := make(map[string]bool)
+	visitedPages := make(map[string]bool)
+
+	for pageURL := u; pageURL != "" && len(visitedPages) < maxCatalogPages; {
+		visitedPages[pageURL] = true
+		timeS := time.Now() // 记录开始时间
 
-			title := strings.TrimSpace(s.Text())
-			if title == "" {
-				return
+		// 加载并解析页面
+		page, doc, err := fetchDocument(ctx, pageURL, siteConfig)
+		if err != nil {
+			if len(visitedPages) == 1 {
+				return nil, err
 			}
+			return nil, NewScrapeError(ErrorTypeLoadFailed, fmt.Sprintf("目录第 %d 页加载失败", len(visitedPages)), err)
+		}
+
+		log.Println("目录页面加载解析完成,耗时:", time.Since(timeS).Seconds(), "秒")
 
-			if strings.Contains(title, "第") { //这种确定链接的方式，有点low，后续进行选择性的抓取
-				chapters = append(chapters, models.ChapterInfo{
-					Index: i + 1,
-					Title: title,
-					URL:   utils.MakeAbsoluteURL(href, u),
-				})
-			} else {
-				log.Println("跳过该a: ", s.Text(), href)
+		// 获取小说标题
+		if catalog.Title == "" {
+			log.Println("正在获取标题...")
+			for _, selector := range siteConfig.NovelTitleSelectors {
+				if title := doc.Find(selector).First().Text(); title != "" {
+					catalog.Title = strings.TrimSpace(title)
+					break
+				}
 			}
-		})
+		}
+		if catalog.Author == "" {
+			catalog.Author = findAuthor(doc, siteConfig)
+		}
+
+		// 获取章节列表
+		log.Println("正在获取章节列表...")
+		for _, selector := range siteConfig.ChapterListSelectors {
+			// 选择器既可以指向章节列表的容器，也可以直接指向章节链接
+			list := doc.Find(selector)
+			list.Find("a").AddSelection(list.Filter("a")).Each(func(i int, s *goquery.Selection) {
+				href, exists := s.Attr("href")
+				if !exists {
+					return
+				}
+
+				title := strings.TrimSpace(s.Text())
+				if title == "" {
+					return
+				}
+
+				if strings.Contains(title, "第") { //这种确定链接的方式，有点low，后续进行选择性的抓取
+					chapterURL := utils.MakeAbsoluteURL(href, page.FinalURL)
+					// 不同的目录页可能重复列出相同的章节（例如"最新章节"）
+					if seenChapters[chapterURL] {
+						return
+					}
+					seenChapters[chapterURL] = true
+					chapters = append(chapters, models.ChapterInfo{
+						Index: len(chapters) + 1,
+						Title: title,
+						URL:   chapterURL,
+					})
+				} else {
+					log.Println("跳过该a: ", s.Text(), href)
+				}
+			})
+		}
+
+		// 获取目录的下一页
+		pageURL = findCatalogNextPage(doc, page.FinalURL, siteConfig)
+		if visitedPages[pageURL] {
+			pageURL = ""
+		}
+		if pageURL != "" {
+			log.Printf("目录第 %d 页处理完成，继续爬取下一页: %s\n", len(visitedPages), pageURL)
+		}
 	}
+	catalog.Title = strings.TrimSpace(catalog.Title)
 
 	if len(chapters) == 0 {
 		return nil, NewScrapeError(ErrorTypeNoContent, "未找到章节列表", nil)
 	}
 
 	catalog.Chapters = chapters
-	log.Printf("成功获取目录，共 %d 章\n", len(chapters))
+	log.Printf("成功获取目录，共 %d 页 %d 章\n", len(visitedPages), len(chapters))
 
 	return catalog, nil
 }
 
+// findAuthor 根据网站配置查找小说作者，去掉"作者："之类的前缀
+func findAuthor(doc *goquery.Document, siteConfig *config.SiteConfig) string {
+	for _, selector := range siteConfig.NovelAuthorSelectors {
+		el := doc.Find(selector).First()
+		author := el.Text()
+		if el.Is("meta") {
+			author, _ = el.Attr("content")
+		}
+		author = strings.TrimSpace(author)
+		for _, prefix := range []string{"作者：", "作者:", "作者"} {
+			author = strings.TrimSpace(strings.TrimPrefix(author, prefix))
+		}
+		if author != "" {
+			return author
+		}
+	}
+	return ""
+}
+
+// findCatalogNextPage 查找目录的下一页链接，没有下一页时返回空字符串
+func findCatalogNextPage(doc *goquery.Document, baseURL string, siteConfig *config.SiteConfig) string {
+	var nextPage string
+
+	// 1. 通过选择器查找
+	for _, selector := range siteConfig.CatalogNextPageSelectors {
+		if href, exists := doc.Find(selector).First().Attr("href"); exists {
+			nextPage = utils.MakeAbsoluteURL(href, baseURL)
+			break
+		}
+	}
+
+	// 2. 通过文本内容查找
+	if nextPage == "" && len(siteConfig.CatalogNextPageKeywords) > 0 {
+		doc.Find("a").EachWithBreak(func(i int, s *goquery.Selection) bool {
+			text := strings.TrimSpace(s.Text())
+			for _, keyword := range siteConfig.CatalogNextPageKeywords {
+				if text == keyword {
+					if href, exists := s.Attr("href"); exists {
+						nextPage = utils.MakeAbsoluteURL(href, baseURL)
+						return false
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	// 最后一页的下一页链接通常是 javascript: 或者指向自身
+	if strings.Contains(nextPage, "javascript:") || nextPage == baseURL {
+		return ""
+	}
+	return nextPage
+}
+
 var maxRetries = 3               // 最大重试次数
 var retryDelay = 1 * time.Second // 减少重试等待时间
 
@@ -132,51 +212,56 @@ func RetryScrapeChapter(ctx context.Context, currentURL string,
 	return nil, lastError
 }
 
-// ScrapeChapter 爬取单个章节的内容
-func ScrapeChapter(ctx context.Context, url string, novel *models.Novel) (*models.Chapter, error) {
-	var chapter models.Chapter
+// maxChapterPages 单个章节最多拼接的分页数
+const maxChapterPages = 50
+
+// chapterPage 章节的一个分页
+type chapterPage struct {
+	// 页面URL
+	url string
+	// 章节标题
+	title string
+	// 正文内容块
+	blocks []models.Block
+	// 下一页或下一章的链接
+	nextLink string
+	// 下一页或下一章链接的文本
+	nextText string
+	// 下一页链接是否根据 URL 规则推测得到
+	guessed bool
+}
 
+// ScrapeChapter 爬取单个章节的内容，章节分为多页时会把所有分页拼接为一个章节
+func ScrapeChapter(ctx context.Context, url string, novel *models.Novel) (*models.Chapter, error) {
 	log.Printf("开始爬取页面: %s\n", url)
 	log.Printf("使用 User-Agent: %s\n", utils.GetRandomUserAgent())
 
-	// 为整个抓取过程创建一个超时上下文
-	timeoutCtx, cancel := context.WithTimeout(ctx, 60*time.Second) // 减少超时时间
-	defer cancel()
+	// 获取网站配置
+	siteConfig := config.GetSiteConfig(url)
+	if siteConfig == nil {
+		return nil, NewScrapeError(ErrorTypeNoConfig, "未找到网站配置", nil)
+	}
 
-	// 创建一个新的 tab
-	taskCtx, cancel := chromedp.NewContext(timeoutCtx)
-	defer cancel()
+	ctx = fetcher.WithPageType(ctx, fetcher.PageChapter)
 
-	// 获取页面 HTML
-	var html string
-	timeS := time.Now() // 记录开始时间
-	log.Println("等待页面加载...")
-	err := chromedp.Run(taskCtx,
-		chromedp.Navigate(url),
-		chromedp.WaitReady("body", chromedp.ByQuery),
-		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
-	)
-	if err != nil {
-		// 检查是否为超时错误
-		if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "deadline exceeded") {
-			return nil, NewScrapeError(ErrorTypeTimeout, "页面加载超时", err)
-		}
-		return nil, NewScrapeError(ErrorTypeLoadFailed, "页面加载失败", err)
+	// 无法解析的页面可能是网站临时返回的错误页面，章节页面的缓存默认不会过期，
+	// 从缓存中删除这次抓取的页面，之后重试时重新抓取
+	var fetched []string
+	fail := func(err error) (*models.Chapter, error) {
+		fetcher.EvictPages(fetched...)
+		return nil, err
 	}
 
-	// 使用 goquery 解析 HTML
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	// 获取并解析页面 HTML
+	timeS := time.Now() // 记录开始时间
+	log.Println("等待页面加载...")
+	page, doc, err := fetchDocument(ctx, url, siteConfig)
 	if err != nil {
-		return nil, NewScrapeError(ErrorTypeParseError, "解析HTML失败", err)
+		return nil, err
 	}
+	fetched = append(fetched, url)
 	log.Println("页面加载解析完成,耗时:", time.Since(timeS).Seconds(), "秒")
 
-	// 获取网站配置
-	siteConfig := config.GetSiteConfig(url)
-	if siteConfig == nil {
-		return nil, NewScrapeError(ErrorTypeNoConfig, "未找到网站配置", nil)
-	}
-
 	// 检查并设置小说标题
 	if novel.Title == "未命名" {
 		log.Println("正在获取小说标题...")
@@ -188,88 +273,155 @@ func ScrapeChapter(ctx context.Context, url string, novel *models.Novel) (*model
 			}
 		}
 	}
+	if novel.Author == "" || novel.Author == "未知" {
+		if author := findAuthor(doc, siteConfig); author != "" {
+			novel.Author = author
+			log.Printf("设置小说作者: %s\n", novel.Author)
+		}
+	}
+
+	first, err := parseChapterPage(doc, url, page.FinalURL, siteConfig)
+	if err != nil {
+		return fail(err)
+	}
+
+	chapter := models.Chapter{
+		Title:    first.title,
+		Blocks:   first.blocks,
+		NextLink: first.nextLink,
+	}
+
+	// 拼接章节的后续分页
+	visited := map[string]bool{url: true, page.FinalURL: true}
+	current := first
+	for pages := 1; pages < maxChapterPages && isChapterContinuation(url, current, siteConfig); pages++ {
+		if visited[current.nextLink] {
+			break
+		}
+		visited[current.nextLink] = true
+
+		log.Printf("章节未完，继续爬取第 %d 页: %s\n", pages+1, current.nextLink)
+		nextPage, nextDoc, err := fetchDocument(ctx, current.nextLink, siteConfig)
+		if err != nil {
+			return nil, err
+		}
+		fetched = append(fetched, current.nextLink)
+		current, err = parseChapterPage(nextDoc, current.nextLink, nextPage.FinalURL, siteConfig)
+		if err != nil {
+			return fail(err)
+		}
+		chapter.Blocks = append(chapter.Blocks, current.blocks...)
+		chapter.NextLink = current.nextLink
+	}
+	if chapter.NextLink != "" && isChapterContinuation(url, current, siteConfig) {
+		// 分页过多或者出现循环，不再把后续分页当作下一章
+		log.Printf("章节分页异常，停止拼接: %s\n", chapter.NextLink)
+		chapter.NextLink = ""
+	}
+
+	log.Printf("成功获取正文，共 %d 段\n", len(chapter.Blocks))
+	log.Printf("获取到下一章链接: %s\n", chapter.NextLink)
+
+	// 逐个清理内容块，清理后为空的内容块会被删除
+	chapter.Title = strings.TrimSpace(chapter.Title)
+	chapter.Blocks = markAuthorNotes(chapter.Blocks)
+	chapter.Blocks = cleanBlocks(chapter.Blocks, newContentCleaner(siteConfig.GetClean()).clean)
+	chapter.Content = models.BlocksText(chapter.Blocks)
+	// 删除用户确认过的、从这个网站的其他章节中学习到的水印
+	if watermarks := watermarksFrom(ctx); watermarks != nil {
+		if RemoveChapterWatermarks(&chapter, watermarks.ForHost(siteConfig.Host)) {
+			log.Printf("已按照水印规则删除章节《%s》中的水印行\n", chapter.Title)
+		}
+	}
+
+	// 确保内容不为空
+	if chapter.Title == "" || chapter.Content == "" {
+		return fail(NewScrapeError(ErrorTypeNoContent, "章节内容或标题为空", nil))
+	}
+
+	return &chapter, nil
+}
+
+// parseChapterPage 解析章节页面的标题、正文和下一页链接
+func parseChapterPage(doc *goquery.Document, url, finalURL string, siteConfig *config.SiteConfig) (*chapterPage, error) {
+	page := &chapterPage{url: url}
 
 	// 获取章节标题
 	log.Println("正在获取标题...")
 	for _, selector := range siteConfig.ChapterTitleSelectors {
 		if title := doc.Find(selector).First().Text(); title != "" {
-			chapter.Title = strings.TrimSpace(title)
+			page.title = strings.TrimSpace(title)
 			break
 		}
 	}
-	if chapter.Title == "" {
+	if page.title == "" {
 		return nil, NewScrapeError(ErrorTypeNoContent, "未找到章节标题", nil)
 	}
-	log.Printf("成功获取标题: %s\n", chapter.Title)
+	log.Printf("成功获取标题: %s\n", page.title)
+
+	// 解析当前页面的URL，用于后面构建图片和下一章的绝对路径
+	baseURL := finalURL // 默认使用当前页面URL
+	if href, exists := doc.Find("base[href]").First().Attr("href"); exists {
+		baseURL = href
+	}
 
 	// 获取内容
 	log.Println("正在获取正文内容...")
-	var content string
 	for _, selector := range siteConfig.ContentSelectors {
 		if contentEl := doc.Find(selector).First(); contentEl.Length() > 0 {
-			// 移除所有 script 标签
+			// 移除所有 script 标签和清理规则中指定的元素
 			contentEl.Find("script").Remove()
+			removeElements(contentEl, siteConfig.GetClean())
 
-			// 获取所有文本节点和段落的内容
-			var paragraphs []string
-			contentEl.Contents().Each(func(i int, s *goquery.Selection) {
-				if s.Is("p") || goquery.NodeName(s) == "#text" {
-					if text := strings.TrimSpace(s.Text()); text != "" {
-						paragraphs = append(paragraphs, text)
-					}
-				}
-			})
-
-			if len(paragraphs) > 0 {
-				content = strings.Join(paragraphs, "\n\n")
+			// 按顺序获取段落、小标题、图片等内容块，跳过分页提示
+			if page.blocks = contentBlocks(contentEl, baseURL, siteConfig); len(page.blocks) > 0 {
 				break
 			}
 
 			// 如果没有找到有效的段落，使用完整文本
-			content = strings.TrimSpace(contentEl.Text())
+			if text := strings.TrimSpace(contentEl.Text()); text != "" {
+				page.blocks = []models.Block{{Type: models.BlockParagraph, Text: text}}
+			}
 			break
 		}
 	}
-	if content == "" {
+	if len(page.blocks) == 0 {
 		return nil, NewScrapeError(ErrorTypeNoContent, "未找到正文内容", nil)
 	}
-	chapter.Content = content
-	log.Printf("成功获取正文，长度: %d 字符\n", len(chapter.Content))
 
 	// 获取下一章链接
 	log.Println("正在获取下一章链接...")
 
-	// 解析当前页面的URL，用于后面构建绝对路径
-	baseURL := url // 默认使用当前页面URL
-	if href, exists := doc.Find("base[href]").First().Attr("href"); exists {
-		baseURL = href
-	}
-
 	// 1. 通过选择器查找
 	for _, selector := range siteConfig.NextChapterSelectors {
-		if href, exists := doc.Find(selector).First().Attr("href"); exists {
-			chapter.NextLink = utils.MakeAbsoluteURL(href, baseURL)
-			break
+		if el := doc.Find(selector).First(); el.Length() > 0 {
+			if href, exists := el.Attr("href"); exists {
+				page.nextLink = utils.MakeAbsoluteURL(href, baseURL)
+				page.nextText = strings.TrimSpace(el.Text())
+				break
+			}
 		}
 	}
 
 	// 2. 通过文本内容查找
-	if chapter.NextLink == "" {
-		doc.Find("a").Each(func(i int, s *goquery.Selection) {
+	if page.nextLink == "" {
+		doc.Find("a").EachWithBreak(func(i int, s *goquery.Selection) bool {
 			text := strings.TrimSpace(s.Text())
 			for _, keyword := range siteConfig.NextChapterKeywords {
 				if strings.Contains(text, keyword) {
 					if href, exists := s.Attr("href"); exists {
-						chapter.NextLink = utils.MakeAbsoluteURL(href, baseURL)
-						return
+						page.nextLink = utils.MakeAbsoluteURL(href, baseURL)
+						page.nextText = text
+						return false
 					}
 				}
 			}
+			return true
 		})
 	}
 
 	// 3. 通过 URL 模式匹配
-	if chapter.NextLink == "" {
+	if page.nextLink == "" {
 		currentPath := strings.TrimPrefix(url, "https://")
 		currentPath = strings.TrimPrefix(currentPath, "http://")
 		if idx := strings.Index(currentPath, "/"); idx != -1 {
@@ -279,26 +431,56 @@ func ScrapeChapter(ctx context.Context, url string, novel *models.Novel) (*model
 			parts := strings.Split(match, "_")
 			if len(parts) > 0 {
 				nextPath := fmt.Sprintf("%s_1.html", parts[0])
-				chapter.NextLink = fmt.Sprintf("%s%s", strings.Split(url, currentPath)[0], nextPath)
+				page.nextLink = fmt.Sprintf("%s%s", strings.Split(url, currentPath)[0], nextPath)
+				page.guessed = true
 			}
 		}
 	}
 
-	log.Printf("获取到下一章链接: %s\n", chapter.NextLink)
+	// 如果下一章链接是 JavaScript:void(0) 或类似的，将其设置为空
+	if strings.Contains(page.nextLink, "javascript:") {
+		page.nextLink = ""
+	}
 
-	// 清理内容
-	chapter.Title = strings.TrimSpace(chapter.Title)
-	chapter.Content = strings.TrimSpace(chapter.Content)
+	return page, nil
+}
 
-	// 如果下一章链接是 JavaScript:void(0) 或类似的，将其设置为空
-	if strings.Contains(chapter.NextLink, "javascript:") || chapter.NextLink == "" {
-		chapter.NextLink = ""
+// isPageMarker 判断段落是否为分页提示，例如"本章未完，点击下一页继续阅读"
+func isPageMarker(text string, siteConfig *config.SiteConfig) bool {
+	for _, marker := range siteConfig.ChapterPageMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChapterContinuation 判断页面的下一页链接是否仍属于当前章节。
+// 配置了 chapterPagePattern 时，比较章节首页和下一页链接中第一个分组的值；
+// 否则根据下一页链接的文本是否为 chapterNextPageKeywords 中的关键词判断
+func isChapterContinuation(chapterURL string, page *chapterPage, siteConfig *config.SiteConfig) bool {
+	if page.nextLink == "" || page.guessed {
+		return false
 	}
 
-	// 确保内容不为空
-	if chapter.Title == "" || chapter.Content == "" {
-		return nil, NewScrapeError(ErrorTypeNoContent, "章节内容或标题为空", nil)
+	if siteConfig.ChapterPagePattern != "" {
+		re, err := regexp.Compile(siteConfig.ChapterPagePattern)
+		if err != nil {
+			log.Printf("章节分页规则 %s 无效: %v\n", siteConfig.ChapterPagePattern, err)
+			return false
+		}
+		current := re.FindStringSubmatch(chapterURL)
+		next := re.FindStringSubmatch(page.nextLink)
+		if len(current) < 2 || len(next) < 2 {
+			return false
+		}
+		return current[1] == next[1]
 	}
 
-	return &chapter, nil
+	for _, keyword := range siteConfig.ChapterNextPageKeywords {
+		if strings.Contains(page.nextText, keyword) {
+			return true
+		}
+	}
+	return false
 }
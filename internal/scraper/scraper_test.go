@@ -0,0 +1,63 @@
+package scraper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chromedp-scraper/internal/fetcher"
+	"chromedp-scraper/internal/models"
+)
+
+// sequenceFetcher 依次返回 pages 中的页面，最后一个页面之后一直返回最后一个
+type sequenceFetcher struct {
+	pages []string
+	calls int
+}
+
+func (f *sequenceFetcher) Fetch(ctx context.Context, url string) (*fetcher.Page, error) {
+	html := f.pages[min(f.calls, len(f.pages)-1)]
+	f.calls++
+	return &fetcher.Page{URL: url, FinalURL: url, StatusCode: 200, HTML: html}, nil
+}
+
+// TestScrapeChapterEvictsBadPage 网站临时返回的错误页面被缓存后，解析失败时从缓存中删除，
+// 之后重新抓取能得到正常的章节
+func TestScrapeChapterEvictsBadPage(t *testing.T) {
+	loadSiteConfigs(t)
+	good, err := os.ReadFile(filepath.Join(fixturesDir, "drxsw.com", "pages", "book", "2002", "1.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &sequenceFetcher{pages: []string{"<html><body><p>网站维护中，请稍后再试</p></body></html>", string(good)}}
+	for _, kind := range []string{fetcher.KindChromedp, fetcher.KindHTTP} {
+		previous := fetcher.Register(kind, f)
+		t.Cleanup(func() { fetcher.Register(kind, previous) })
+	}
+	// 章节页面的缓存永不过期
+	fetcher.EnableCache(t.TempDir(), map[string]time.Duration{fetcher.PageChapter: 0})
+	t.Cleanup(fetcher.DisableCache)
+
+	ctx := context.Background()
+	u := "http://www.drxsw.com/book/2002/1.html"
+	if _, err := ScrapeChapter(ctx, u, &models.Novel{Title: "未命名"}); err == nil {
+		t.Fatal("错误页面应该解析失败")
+	}
+	chapter, err := ScrapeChapter(ctx, u, &models.Novel{Title: "未命名"})
+	if err != nil {
+		t.Fatalf("错误页面被缓存，重新抓取仍然失败: %v", err)
+	}
+	if chapter.Content == "" || f.calls != 2 {
+		t.Errorf("抓取了 %d 次，章节内容为 %q，期望重新抓取到正常的章节", f.calls, chapter.Content)
+	}
+
+	// 正常的章节页面继续使用缓存
+	if _, err := ScrapeChapter(ctx, u, &models.Novel{Title: "未命名"}); err != nil {
+		t.Fatal(err)
+	}
+	if f.calls != 2 {
+		t.Errorf("正常的章节页面没有使用缓存，抓取了 %d 次", f.calls)
+	}
+}
@@ -0,0 +1,246 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/fetcher"
+	"chromedp-scraper/internal/models"
+)
+
+// update 为 true 时根据当前的抓取结果重写 golden.json
+var update = flag.Bool("update", false, "根据当前的抓取结果重写 testdata/sites/*/golden.json")
+
+const (
+	// sitesConfigPath 测试使用的网站配置
+	sitesConfigPath = "../../configs/sites.json"
+	// fixturesDir 每个网站的测试页面和期望结果，目录名为网站配置中的 host
+	fixturesDir = "testdata/sites"
+)
+
+// golden 一个网站的期望抓取结果，键为页面URL
+type golden struct {
+	Catalogs map[string]*catalogResult `json:"catalogs"`
+	Chapters map[string]*chapterResult `json:"chapters"`
+}
+
+// catalogResult ScrapeCatalog 的抓取结果
+type catalogResult struct {
+	Title        string           `json:"title"`
+	Author       string           `json:"author"`
+	ChapterCount int              `json:"chapterCount"`
+	Chapters     []catalogChapter `json:"chapters"`
+}
+
+// catalogChapter 目录中的章节
+type catalogChapter struct {
+	Index int    `json:"index"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// chapterResult ScrapeChapter 的抓取结果
+type chapterResult struct {
+	NovelTitle  string         `json:"novelTitle"`
+	NovelAuthor string         `json:"novelAuthor"`
+	Title       string         `json:"title"`
+	Content     string         `json:"content"`
+	Blocks      []models.Block `json:"blocks"`
+	NextLink    string         `json:"nextLink"`
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// TestSiteFixtures 使用保存的网页检查每个已配置网站的目录和章节解析结果
+func TestSiteFixtures(t *testing.T) {
+	loadSiteConfigs(t)
+	startFixtureServer(t)
+	ctx := context.Background()
+
+	for _, site := range config.SiteConfigs() {
+		t.Run(site.Host, func(t *testing.T) {
+			dir := filepath.Join(fixturesDir, site.Host)
+			want := loadGolden(t, dir)
+			got := &golden{
+				Catalogs: make(map[string]*catalogResult),
+				Chapters: make(map[string]*chapterResult),
+			}
+
+			for _, u := range sortedKeys(want.Catalogs) {
+				catalog, err := ScrapeCatalog(ctx, u)
+				if err != nil {
+					t.Errorf("ScrapeCatalog(%s) 失败: %v", u, err)
+					continue
+				}
+				result := &catalogResult{
+					Title:        catalog.Title,
+					Author:       catalog.Author,
+					ChapterCount: len(catalog.Chapters),
+				}
+				for _, c := range catalog.Chapters {
+					result.Chapters = append(result.Chapters, catalogChapter{Index: c.Index, Title: c.Title, URL: c.URL})
+				}
+				got.Catalogs[u] = result
+				compareResult(t, "目录 "+u, want.Catalogs[u], got.Catalogs[u])
+			}
+
+			for _, u := range sortedKeys(want.Chapters) {
+				novel := &models.Novel{Title: "未命名", Author: "未知"}
+				chapter, err := ScrapeChapter(ctx, u, novel)
+				if err != nil {
+					t.Errorf("ScrapeChapter(%s) 失败: %v", u, err)
+					continue
+				}
+				got.Chapters[u] = &chapterResult{
+					NovelTitle:  novel.Title,
+					NovelAuthor: novel.Author,
+					Title:       chapter.Title,
+					Content:     chapter.Content,
+					Blocks:      chapter.Blocks,
+					NextLink:    chapter.NextLink,
+				}
+				compareResult(t, "章节 "+u, want.Chapters[u], got.Chapters[u])
+			}
+
+			if *update {
+				saveGolden(t, dir, got)
+			}
+		})
+	}
+}
+
+// loadSiteConfigs 加载 configs/sites.json，并去掉访问频率限制
+func loadSiteConfigs(t *testing.T) {
+	t.Helper()
+	if err := config.ReloadConfig(sitesConfigPath); err != nil {
+		t.Fatalf("加载网站配置失败: %v", err)
+	}
+	for _, site := range config.SiteConfigs() {
+		site.RateLimit = &config.RateLimitConfig{}
+	}
+}
+
+// startFixtureServer 启动提供 testdata/sites 中网页的测试服务器，并让所有抓取方式都通过它获取页面。
+// 请求中的域名保持不变，因此 GetSiteConfig 仍然能匹配到网站配置，
+// 测试服务器根据请求的 Host 选择网站目录，页面保存在 pages/ 下与URL路径相同的位置，
+// 以 / 结尾的路径对应 index.html
+func startFixtureServer(t *testing.T) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(serveFixture))
+	t.Cleanup(srv.Close)
+
+	addr := srv.Listener.Addr().String()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	f := &fetcher.HTTPFetcher{Client: client}
+	for _, kind := range []string{fetcher.KindChromedp, fetcher.KindHTTP} {
+		previous := fetcher.Register(kind, f)
+		t.Cleanup(func() { fetcher.Register(kind, previous) })
+	}
+}
+
+// serveFixture 返回请求的网站和路径对应的测试页面
+func serveFixture(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(fixturesDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.Contains(host, entry.Name()) {
+			continue
+		}
+		name := path.Clean(r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		data, err := os.ReadFile(filepath.Join(fixturesDir, entry.Name(), "pages", filepath.FromSlash(name)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		// 和很多网站一样不在响应头中声明编码，由 meta 标签和页面内容决定
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(data)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// loadGolden 读取网站的期望结果，每个已配置的网站都需要有测试页面
+func loadGolden(t *testing.T, dir string) *golden {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "golden.json"))
+	if err != nil {
+		t.Fatalf("读取期望结果失败，每个网站都需要在 %s 中保存测试页面和 golden.json: %v", fixturesDir, err)
+	}
+	var g golden
+	if err := json.Unmarshal(data, &g); err != nil {
+		t.Fatalf("解析 %s/golden.json 失败: %v", dir, err)
+	}
+	if len(g.Catalogs) == 0 && len(g.Chapters) == 0 {
+		t.Fatalf("%s/golden.json 中没有需要检查的页面", dir)
+	}
+	return &g
+}
+
+// saveGolden 将抓取结果写入 golden.json
+func saveGolden(t *testing.T, dir string, g *golden) {
+	t.Helper()
+	data, err := json.MarshalIndent(g, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "golden.json"), append(data, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// compareResult 比较抓取结果和期望结果，使用 -update 时只记录新的结果
+func compareResult[T any](t *testing.T, name string, want, got *T) {
+	t.Helper()
+	if *update || reflect.DeepEqual(want, got) {
+		return
+	}
+	wantJSON, _ := json.MarshalIndent(want, "", "  ")
+	gotJSON, _ := json.MarshalIndent(got, "", "  ")
+	t.Errorf("%s 的抓取结果与期望不一致\n期望:\n%s\n实际:\n%s", name, wantJSON, gotJSON)
+}
+
+// sortedKeys 返回排序后的页面URL
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,259 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"chromedp-scraper/internal/models"
+)
+
+// WatermarkOptions 水印检测参数
+type WatermarkOptions struct {
+	// 至少出现在多少个章节中
+	MinChapters int
+	// 至少出现在多少比例的章节中，总是出现在相同位置的行只需要一半的比例
+	Ratio float64
+}
+
+// DefaultWatermarkOptions 返回默认的水印检测参数
+func DefaultWatermarkOptions() WatermarkOptions {
+	return WatermarkOptions{MinChapters: 3, Ratio: 0.3}
+}
+
+// WatermarkCandidate 检测到的疑似水印行
+type WatermarkCandidate struct {
+	// 删除这一行的规则
+	Rule models.WatermarkRule
+	// 出现的章节数和检测的章节数
+	Chapters int
+	Total    int
+	// 固定出现的位置，例如"开头第 1 行"，位置不固定时为空
+	Position string
+	// 出现的原文
+	Example string
+}
+
+// digitsPattern 匹配行中的数字，数字不同的行视为同一行
+var digitsPattern = regexp.MustCompile(`[0-9０-９]+`)
+
+// 检测时只比较章节开头和结尾的几行是否出现在相同位置
+const watermarkEdgeLines = 3
+
+// lineStats 同一行在各章节中出现的情况
+type lineStats struct {
+	chapters  int
+	texts     map[string]bool
+	example   string
+	positions map[int]int
+}
+
+// DetectWatermarks 找出在很多章节中反复出现、或者总是出现在章节开头或结尾相同位置的行，
+// 对话和只有标点的分隔行不会被当作水印，行中只有数字不同时生成正则表达式规则
+func DetectWatermarks(chapters []*models.Chapter, opts WatermarkOptions) []*WatermarkCandidate {
+	total := len(chapters)
+	if total < opts.MinChapters || total == 0 {
+		return nil
+	}
+
+	stats := make(map[string]*lineStats)
+	for _, chapter := range chapters {
+		var lines []string
+		for _, line := range strings.Split(chapter.Content, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+
+		seen := make(map[string]bool)
+		for i, line := range lines {
+			if !watermarkLike(line) {
+				continue
+			}
+			key := digitsPattern.ReplaceAllString(line, "#")
+			s := stats[key]
+			if s == nil {
+				s = &lineStats{texts: make(map[string]bool), example: line, positions: make(map[int]int)}
+				stats[key] = s
+			}
+			s.texts[line] = true
+			if i < watermarkEdgeLines {
+				s.positions[i+1]++
+			}
+			if fromEnd := len(lines) - i; fromEnd <= watermarkEdgeLines {
+				s.positions[-fromEnd]++
+			}
+			if !seen[key] {
+				seen[key] = true
+				s.chapters++
+			}
+		}
+	}
+
+	repeatThreshold := max(opts.MinChapters, int(math.Ceil(opts.Ratio*float64(total))))
+	positionThreshold := max(opts.MinChapters, int(math.Ceil(opts.Ratio/2*float64(total))))
+	var candidates []*WatermarkCandidate
+	for _, s := range stats {
+		position, count := 0, 0
+		for p, c := range s.positions {
+			if c > count || (c == count && p < position) {
+				position, count = p, c
+			}
+		}
+		if s.chapters < repeatThreshold && count < positionThreshold {
+			continue
+		}
+
+		candidate := &WatermarkCandidate{Chapters: s.chapters, Total: total, Example: s.example}
+		if count >= positionThreshold {
+			candidate.Position = positionName(position)
+		}
+		if len(s.texts) == 1 {
+			candidate.Rule.Text = s.example
+		} else {
+			candidate.Rule.Pattern = digitsRulePattern(s.example)
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Chapters != candidates[j].Chapters {
+			return candidates[i].Chapters > candidates[j].Chapters
+		}
+		return candidates[i].Example < candidates[j].Example
+	})
+	return candidates
+}
+
+// watermarkLike 判断一行是否可能是水印：对话和没有文字的分隔行不是水印
+func watermarkLike(line string) bool {
+	if utf8.RuneCountInString(line) < 2 || isDialogue(line) {
+		return false
+	}
+	return strings.IndexFunc(line, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
+
+// isDialogue 判断一行是否为对话，对话中的"嗯""好"之类的短句在很多章节中都会出现
+func isDialogue(line string) bool {
+	if strings.ContainsAny(line, "“”「」『』") {
+		return true
+	}
+	return strings.HasPrefix(line, "\"") || strings.HasPrefix(line, "'") || strings.HasPrefix(line, "‘")
+}
+
+// positionName 返回位置的说明，正数为从开头数第几行，负数为从结尾数第几行
+func positionName(position int) string {
+	if position > 0 {
+		return fmt.Sprintf("开头第 %d 行", position)
+	}
+	return fmt.Sprintf("结尾第 %d 行", -position)
+}
+
+// digitsRulePattern 把行中的数字替换为匹配任意数字的正则表达式
+func digitsRulePattern(line string) string {
+	parts := digitsPattern.Split(line, -1)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, digitsPattern.String())
+}
+
+type watermarksKey struct{}
+
+// WithWatermarks 附加抓取章节时使用的水印规则，规则在每次爬取开始时加载一次，
+// 抓取章节时只使用章节所属网站的规则；没有附加规则时不删除水印
+func WithWatermarks(ctx context.Context, watermarks *models.Watermarks) context.Context {
+	return context.WithValue(ctx, watermarksKey{}, watermarks)
+}
+
+// watermarksFrom 返回上下文中的水印规则，没有时返回 nil
+func watermarksFrom(ctx context.Context) *models.Watermarks {
+	watermarks, _ := ctx.Value(watermarksKey{}).(*models.Watermarks)
+	return watermarks
+}
+
+// RemoveWatermarks 删除正文中和水印规则整行匹配的行，并合并删除后留下的连续空行
+func RemoveWatermarks(content string, rules []*models.WatermarkRule) string {
+	if len(rules) == 0 {
+		return content
+	}
+	return newWatermarkMatcher(rules).remove(content)
+}
+
+// RemoveChapterWatermarks 删除章节中的水印行，有内容块时逐个处理内容块并重新生成纯文本正文，
+// 返回章节是否被修改
+func RemoveChapterWatermarks(chapter *models.Chapter, rules []*models.WatermarkRule) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	m := newWatermarkMatcher(rules)
+	if chapter.Blocks == nil {
+		content := m.remove(chapter.Content)
+		changed := content != chapter.Content
+		chapter.Content = content
+		return changed
+	}
+	chapter.Blocks = cleanBlocks(chapter.Blocks, m.remove)
+	content := models.BlocksText(chapter.Blocks)
+	changed := content != chapter.Content
+	chapter.Content = content
+	return changed
+}
+
+// watermarkMatcher 编译好的水印规则
+type watermarkMatcher struct {
+	texts    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func newWatermarkMatcher(rules []*models.WatermarkRule) *watermarkMatcher {
+	m := &watermarkMatcher{texts: make(map[string]bool)}
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			m.texts[rule.Text] = true
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + rule.Pattern + ")$")
+		if err != nil {
+			log.Printf("水印规则 %s 无效: %v\n", rule.Pattern, err)
+			continue
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m
+}
+
+// remove 删除和水印规则整行匹配的行，没有删除任何行时返回原来的内容
+func (m *watermarkMatcher) remove(content string) string {
+	lines := strings.Split(content, "\n")
+	kept := lines[:0]
+	removed := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && (m.texts[trimmed] || matchAny(m.patterns, trimmed)) {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return content
+	}
+	return strings.TrimSpace(collapseBlankLines(strings.Join(kept, "\n")))
+}
+
+func matchAny(patterns []*regexp.Regexp, line string) bool {
+	for _, re := range patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"chromedp-scraper/internal/crawler"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// 任务状态
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// JobRequest 提交爬取任务的请求
+type JobRequest struct {
+	// 目录页链接或起始章节链接
+	URL string `json:"url"`
+	// 爬取模式：catalog 或 follow，默认 catalog
+	Mode string `json:"mode"`
+	// 同时爬取的章节数，0 表示使用服务的默认值
+	Workers int `json:"workers,omitempty"`
+	// 起始章节序号
+	Start int `json:"start,omitempty"`
+	// 结束章节序号
+	End int `json:"end,omitempty"`
+	// 爬取完成后导出 EPUB
+	EPUB bool `json:"epub,omitempty"`
+}
+
+// JobInfo 爬取任务的状态
+type JobInfo struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Mode    string `json:"mode"`
+	NovelID string `json:"novelId"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+
+	CreatedTime  int64 `json:"createdTime"`
+	StartedTime  int64 `json:"startedTime,omitempty"`
+	FinishedTime int64 `json:"finishedTime,omitempty"`
+}
+
+// Job 爬取任务，JobInfo 由 Server 加锁后修改
+type Job struct {
+	JobInfo
+
+	opts crawler.Options
+	// 关闭后不再爬取新的章节
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Progress 小说的爬取进度，来自章节清单
+type Progress struct {
+	Title         string                  `json:"title"`
+	Total         int                     `json:"total"`
+	Done          int                     `json:"done"`
+	Failed        int                     `json:"failed"`
+	Pending       int                     `json:"pending"`
+	Skipped       int                     `json:"skipped"`
+	MergedChapter int                     `json:"mergedChapter"`
+	IsCompleted   bool                    `json:"isCompleted"`
+	Chapters      []*models.ChapterRecord `json:"chapters,omitempty"`
+}
+
+// jobView 返回给客户端的任务信息
+type jobView struct {
+	JobInfo
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// newJob 根据请求创建任务
+func newJob(id string, req JobRequest, defaults crawler.Options) (*Job, error) {
+	if req.URL == "" {
+		return nil, fmt.Errorf("请提供目录页或起始章节的URL")
+	}
+	if req.Mode == "" {
+		req.Mode = models.ModeCatalog
+	}
+	if req.Mode != models.ModeCatalog && req.Mode != models.ModeFollow {
+		return nil, fmt.Errorf("不支持的爬取模式: %s", req.Mode)
+	}
+
+	opts := defaults
+	if req.Workers > 0 {
+		opts.WorkerCount = req.Workers
+	}
+	if req.Start > 0 {
+		opts.StartChapter = req.Start
+	}
+	if req.End > 0 {
+		opts.EndChapter = req.End
+	}
+	opts.EPUB = opts.EPUB || req.EPUB
+
+	job := &Job{
+		JobInfo: JobInfo{
+			ID:          id,
+			URL:         req.URL,
+			Mode:        req.Mode,
+			NovelID:     utils.GetNovelIdentifier(req.URL),
+			Status:      JobQueued,
+			CreatedTime: time.Now().Unix(),
+		},
+		opts: opts,
+		stop: make(chan struct{}),
+	}
+	return job, nil
+}
+
+// active 任务是否还没有结束
+func (j *Job) active() bool {
+	return j.Status == JobQueued || j.Status == JobRunning
+}
+
+// run 执行任务，ctx 收到停止信号或者任务被取消后不再爬取新的章节
+func (j *Job) run(ctx context.Context) error {
+	// 服务停止时同样停止任务，任务结束后不再等待
+	stopped := crawler.Stopped(ctx)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stopped:
+			j.cancel()
+		case <-j.stop:
+		case <-done:
+		}
+	}()
+	ctx = crawler.WithStop(ctx, j.stop)
+
+	log.Printf("开始执行任务 %s: %s\n", j.ID, j.URL)
+	if j.Mode == models.ModeFollow {
+		return crawler.LoadNovelFromFirstChapterLink(ctx, j.URL, j.opts)
+	}
+	return crawler.LoadNovelFromCategoryChapterLink(ctx, j.URL, j.opts)
+}
+
+// cancel 停止任务，正在爬取的章节会继续完成
+func (j *Job) cancel() {
+	j.stopOnce.Do(func() { close(j.stop) })
+}
+
+// loadProgress 从章节清单读取小说的爬取进度
+func loadProgress(novelID string, withChapters bool) (*Progress, error) {
+	ws, err := utils.LookupWorkspace(novelID)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &Progress{
+		Title:         manifest.Title,
+		Total:         len(manifest.Chapters),
+		Done:          manifest.Count(models.ChapterDone),
+		Failed:        manifest.Count(models.ChapterFailed),
+		Pending:       manifest.Count(models.ChapterPending),
+		Skipped:       manifest.Count(models.ChapterSkipped),
+		MergedChapter: manifest.MergedChapterNum,
+		IsCompleted:   manifest.IsCompleted,
+	}
+	if withChapters {
+		progress.Chapters = manifest.Chapters
+	}
+	return progress, nil
+}
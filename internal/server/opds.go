@@ -0,0 +1,333 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// OPDS 1.2 使用的媒体类型和链接关系
+const (
+	opdsNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsAcquisitionRel  = "http://opds-spec.org/acquisition"
+	opdsSortNewRel      = "http://opds-spec.org/sort/new"
+	epubMediaType       = "application/epub+zip"
+	txtMediaType        = "text/plain; charset=utf-8"
+
+	// opdsRecentLimit 最近更新列表中的小说数
+	opdsRecentLimit = 50
+)
+
+// opdsFeed OPDS 目录，即 Atom feed
+type opdsFeed struct {
+	XMLName xml.Name     `xml:"feed"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	DCNS    string       `xml:"xmlns:dc,attr"`
+	OPDSNS  string       `xml:"xmlns:opds,attr"`
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Author  *opdsAuthor  `xml:"author,omitempty"`
+	Links   []opdsLink   `xml:"link"`
+	Entries []*opdsEntry `xml:"entry"`
+}
+
+// opdsEntry 导航条目或小说条目
+type opdsEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Authors  []opdsAuthor `xml:"author,omitempty"`
+	Language string       `xml:"dc:language,omitempty"`
+	Content  *opdsContent `xml:"content,omitempty"`
+	Links    []opdsLink   `xml:"link"`
+}
+
+type opdsAuthor struct {
+	Name string `xml:"name"`
+}
+
+type opdsContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type opdsLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+// opdsNovel 已经完成的小说
+type opdsNovel struct {
+	ID      string
+	Title   string
+	Author  string
+	Site    *config.SiteConfig
+	Updated time.Time
+	// 导出文件名和媒体类型
+	Exports []opdsLink
+}
+
+func (s *Server) handleOPDSRoot(w http.ResponseWriter, r *http.Request) {
+	novels, err := completedNovels()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	feed := newOPDSFeed("urn:chromedp-scraper:opds", "小说书库", "/opds", opdsNavigationType, latest(novels))
+	feed.Entries = []*opdsEntry{
+		navigationEntry("urn:chromedp-scraper:opds:all", "全部小说",
+			fmt.Sprintf("已经完成的 %d 本小说", len(novels)), "/opds/all", "subsection", opdsAcquisitionType, latest(novels)),
+		navigationEntry("urn:chromedp-scraper:opds:recent", "最近更新",
+			"按照更新时间排列", "/opds/recent", opdsSortNewRel, opdsAcquisitionType, latest(novels)),
+		navigationEntry("urn:chromedp-scraper:opds:sites", "按网站浏览",
+			"按照来源网站分类", "/opds/sites", "subsection", opdsNavigationType, latest(novels)),
+	}
+	writeFeed(w, feed, opdsNavigationType)
+}
+
+func (s *Server) handleOPDSAll(w http.ResponseWriter, r *http.Request) {
+	novels, err := completedNovels()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sort.Slice(novels, func(i, j int) bool { return novels[i].Title < novels[j].Title })
+	writeAcquisitionFeed(w, "urn:chromedp-scraper:opds:all", "全部小说", "/opds/all", novels)
+}
+
+func (s *Server) handleOPDSRecent(w http.ResponseWriter, r *http.Request) {
+	novels, err := completedNovels()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sort.Slice(novels, func(i, j int) bool { return novels[i].Updated.After(novels[j].Updated) })
+	if len(novels) > opdsRecentLimit {
+		novels = novels[:opdsRecentLimit]
+	}
+	writeAcquisitionFeed(w, "urn:chromedp-scraper:opds:recent", "最近更新", "/opds/recent", novels)
+}
+
+func (s *Server) handleOPDSSites(w http.ResponseWriter, r *http.Request) {
+	novels, err := completedNovels()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	bySite := make(map[string][]*opdsNovel)
+	sites := make(map[string]*config.SiteConfig)
+	for _, novel := range novels {
+		bySite[novel.Site.Host] = append(bySite[novel.Site.Host], novel)
+		sites[novel.Site.Host] = novel.Site
+	}
+	hosts := make([]string, 0, len(sites))
+	for host := range sites {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	feed := newOPDSFeed("urn:chromedp-scraper:opds:sites", "按网站浏览", "/opds/sites", opdsNavigationType, latest(novels))
+	for _, host := range hosts {
+		feed.Entries = append(feed.Entries, navigationEntry(
+			"urn:chromedp-scraper:opds:site:"+host, siteName(sites[host]),
+			fmt.Sprintf("%s，%d 本小说", host, len(bySite[host])),
+			"/opds/sites/"+url.PathEscape(host), "subsection", opdsAcquisitionType, latest(bySite[host])))
+	}
+	writeFeed(w, feed, opdsNavigationType)
+}
+
+func (s *Server) handleOPDSSite(w http.ResponseWriter, r *http.Request) {
+	novels, err := completedNovels()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	host := r.PathValue("host")
+	var site []*opdsNovel
+	for _, novel := range novels {
+		if novel.Site.Host == host {
+			site = append(site, novel)
+		}
+	}
+	if len(site) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("网站 %s 没有已经完成的小说", host))
+		return
+	}
+	sort.Slice(site, func(i, j int) bool { return site[i].Title < site[j].Title })
+	writeAcquisitionFeed(w, "urn:chromedp-scraper:opds:site:"+host, siteName(site[0].Site),
+		"/opds/sites/"+url.PathEscape(host), site)
+}
+
+// completedNovels 读取所有已经完成并且有导出文件的小说
+func completedNovels() ([]*opdsNovel, error) {
+	workspaces, err := utils.ListWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var novels []*opdsNovel
+	for _, ws := range workspaces {
+		manifest, err := utils.LoadManifest(ws)
+		if err != nil {
+			log.Printf("读取章节清单 %s 失败: %v\n", ws.ManifestPath(), err)
+			continue
+		}
+		if !manifest.IsCompleted {
+			continue
+		}
+		meta, err := ws.LoadMeta()
+		if err != nil || meta == nil {
+			meta = &models.NovelMeta{Title: manifest.Title}
+		}
+		if meta.Title == "" {
+			continue
+		}
+
+		novel := &opdsNovel{
+			ID:      ws.ID,
+			Title:   meta.Title,
+			Author:  meta.Author,
+			Site:    novelSite(meta.SourceURL),
+			Updated: time.Unix(max(manifest.LastUpdateTime, meta.LastUpdateTime), 0),
+		}
+		for _, export := range []struct{ path, mediaType string }{
+			{ws.EPUBFilePath(meta.Title), epubMediaType},
+			{ws.MergedFilePath(meta.Title), txtMediaType},
+		} {
+			info, err := os.Stat(export.path)
+			if err != nil {
+				continue
+			}
+			if info.ModTime().After(novel.Updated) {
+				novel.Updated = info.ModTime()
+			}
+			name := filepath.Base(export.path)
+			novel.Exports = append(novel.Exports, opdsLink{
+				Rel:   opdsAcquisitionRel,
+				Href:  "/api/novels/" + url.PathEscape(ws.ID) + "/exports/" + url.PathEscape(name),
+				Type:  export.mediaType,
+				Title: name,
+			})
+		}
+		if len(novel.Exports) > 0 {
+			novels = append(novels, novel)
+		}
+	}
+	return novels, nil
+}
+
+// novelSite 返回小说来源网站的配置，没有配置时使用链接中的域名
+func novelSite(sourceURL string) *config.SiteConfig {
+	if site := config.GetSiteConfig(sourceURL); site != nil {
+		return site
+	}
+	host := "unknown"
+	if u, err := url.Parse(sourceURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return &config.SiteConfig{Host: host}
+}
+
+// siteName 返回网站名称，没有配置名称时使用 Host
+func siteName(site *config.SiteConfig) string {
+	if site.Name != "" {
+		return site.Name
+	}
+	return site.Host
+}
+
+// latest 返回小说中最近的更新时间
+func latest(novels []*opdsNovel) time.Time {
+	var updated time.Time
+	for _, novel := range novels {
+		if novel.Updated.After(updated) {
+			updated = novel.Updated
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	return updated
+}
+
+// newOPDSFeed 创建带有 self 和 start 链接的目录
+func newOPDSFeed(id, title, self, selfType string, updated time.Time) *opdsFeed {
+	return &opdsFeed{
+		XMLNS:   "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/terms/",
+		OPDSNS:  "http://opds-spec.org/2010/catalog",
+		ID:      id,
+		Title:   title,
+		Updated: atomTime(updated),
+		Author:  &opdsAuthor{Name: "chromedp-scraper"},
+		Links: []opdsLink{
+			{Rel: "self", Href: self, Type: selfType},
+			{Rel: "start", Href: "/opds", Type: opdsNavigationType},
+		},
+	}
+}
+
+// navigationEntry 创建指向子目录的导航条目
+func navigationEntry(id, title, content, href, rel, linkType string, updated time.Time) *opdsEntry {
+	return &opdsEntry{
+		ID:      id,
+		Title:   title,
+		Updated: atomTime(updated),
+		Content: &opdsContent{Type: "text", Text: content},
+		Links:   []opdsLink{{Rel: rel, Href: href, Type: linkType}},
+	}
+}
+
+// writeAcquisitionFeed 返回列出小说和下载链接的目录
+func writeAcquisitionFeed(w http.ResponseWriter, id, title, self string, novels []*opdsNovel) {
+	feed := newOPDSFeed(id, title, self, opdsAcquisitionType, latest(novels))
+	feed.Links = append(feed.Links, opdsLink{Rel: "up", Href: "/opds", Type: opdsNavigationType})
+	for _, novel := range novels {
+		entry := &opdsEntry{
+			ID:       "urn:chromedp-scraper:novel:" + novel.ID,
+			Title:    novel.Title,
+			Updated:  atomTime(novel.Updated),
+			Language: "zh",
+			Content:  &opdsContent{Type: "text", Text: "来源：" + siteName(novel.Site)},
+			Links:    novel.Exports,
+		}
+		if novel.Author != "" {
+			entry.Authors = []opdsAuthor{{Name: novel.Author}}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	writeFeed(w, feed, opdsAcquisitionType)
+}
+
+// writeFeed 以 Atom XML 格式返回目录
+func writeFeed(w http.ResponseWriter, feed *opdsFeed, mediaType string) {
+	w.Header().Set("Content-Type", mediaType+";charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("返回 OPDS 目录失败: %v\n", err)
+	}
+}
+
+// atomTime 按照 RFC 3339 格式化时间
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// web 阅读器页面
+//
+//go:embed web
+var web embed.FS
+
+// TOCEntry 目录中的章节
+type TOCEntry struct {
+	Index  int    `json:"index"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	// 章节已经下载，可以阅读
+	Available bool `json:"available"`
+}
+
+// ChapterView 阅读器中显示的章节
+type ChapterView struct {
+	Index      int      `json:"index"`
+	Title      string   `json:"title"`
+	Paragraphs []string `json:"paragraphs"`
+	// 上一章和下一章的序号，没有时为 0
+	Prev int `json:"prev,omitempty"`
+	Next int `json:"next,omitempty"`
+}
+
+// webHandler 返回阅读器页面的处理器
+func webHandler() http.Handler {
+	sub, err := fs.Sub(web, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServerFS(sub)
+}
+
+func (s *Server) handleTOC(w http.ResponseWriter, r *http.Request) {
+	ws, ok := findWorkspace(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	toc := make([]TOCEntry, 0, len(manifest.Chapters))
+	for _, record := range manifest.Chapters {
+		toc = append(toc, TOCEntry{
+			Index:     record.Index,
+			Title:     record.Title,
+			Status:    string(record.Status),
+			Available: record.Status == models.ChapterDone,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":       ws.ID,
+		"title":    novelTitle(ws, manifest),
+		"chapters": toc,
+	})
+}
+
+func (s *Server) handleChapter(w http.ResponseWriter, r *http.Request) {
+	ws, ok := findWorkspace(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("无效的章节序号: %s", r.PathValue("index")))
+		return
+	}
+	manifest, err := utils.LoadManifest(ws)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	record := manifest.Chapter(index)
+	if record == nil || record.Status != models.ChapterDone {
+		writeError(w, http.StatusNotFound, fmt.Errorf("第 %d 章还没有下载", index))
+		return
+	}
+	chapter, err := utils.LoadChapter(ws, novelTitle(ws, manifest), index)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	view := ChapterView{Index: index, Title: chapter.Title, Paragraphs: []string{}}
+	if view.Title == "" {
+		view.Title = record.Title
+	}
+	for _, line := range strings.Split(chapter.Content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			view.Paragraphs = append(view.Paragraphs, line)
+		}
+	}
+	// 跳过还没有下载的章节
+	for _, record := range manifest.Chapters {
+		if record.Status != models.ChapterDone {
+			continue
+		}
+		if record.Index < index {
+			view.Prev = record.Index
+		} else if record.Index > index && view.Next == 0 {
+			view.Next = record.Index
+		}
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+func (s *Server) handleGetPosition(w http.ResponseWriter, r *http.Request) {
+	ws, ok := findWorkspace(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	position, err := utils.LoadReadingPosition(ws)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if position == nil {
+		position = &models.ReadingPosition{}
+	}
+	writeJSON(w, http.StatusOK, position)
+}
+
+func (s *Server) handleSavePosition(w http.ResponseWriter, r *http.Request) {
+	ws, ok := findWorkspace(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	var position models.ReadingPosition
+	if err := json.NewDecoder(r.Body).Decode(&position); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求格式错误: %v", err))
+		return
+	}
+	if position.Chapter < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("无效的章节序号: %d", position.Chapter))
+		return
+	}
+	position.Offset = min(max(position.Offset, 0), 1)
+	if err := utils.SaveReadingPosition(ws, &position); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, position)
+}
+
+// novelTitle 返回小说标题，优先使用元数据中的标题
+func novelTitle(ws *utils.Workspace, manifest *models.Manifest) string {
+	if meta, err := ws.LoadMeta(); err == nil && meta != nil && meta.Title != "" {
+		return meta.Title
+	}
+	return manifest.Title
+}
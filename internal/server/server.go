@@ -0,0 +1,394 @@
+// Package server 提供本地 HTTP 接口，用于提交爬取任务、查看进度和下载导出文件
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chromedp-scraper/internal/crawler"
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+// Server 管理爬取任务并提供 HTTP 接口
+type Server struct {
+	ctx  context.Context
+	opts crawler.Options
+	// 同时执行的任务数
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []string
+	nextID int
+}
+
+// NovelInfo 工作目录中的小说
+type NovelInfo struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author,omitempty"`
+	SourceURL string    `json:"sourceUrl,omitempty"`
+	Progress  *Progress `json:"progress,omitempty"`
+	Exports   []string  `json:"exports"`
+	// 阅读进度
+	Position *models.ReadingPosition `json:"position,omitempty"`
+}
+
+// New 创建服务，ctx 收到停止信号后正在执行的任务不再爬取新的章节，
+// parallel 为同时执行的任务数
+func New(ctx context.Context, opts crawler.Options, parallel int) *Server {
+	if parallel < 1 {
+		parallel = 1
+	}
+	return &Server{
+		ctx:  ctx,
+		opts: opts,
+		sem:  make(chan struct{}, parallel),
+		jobs: make(map[string]*Job),
+	}
+}
+
+// Handler 返回 HTTP 接口、阅读器页面和 OPDS 目录的处理器
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/jobs", s.handleSubmitJob)
+	mux.HandleFunc("GET /api/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("POST /api/jobs/{id}/cancel", s.handleCancelJob)
+	mux.HandleFunc("DELETE /api/jobs/{id}", s.handleCancelJob)
+	mux.HandleFunc("GET /api/novels", s.handleListNovels)
+	mux.HandleFunc("GET /api/novels/{id}", s.handleGetNovel)
+	mux.HandleFunc("GET /api/novels/{id}/exports", s.handleListExports)
+	mux.HandleFunc("GET /api/novels/{id}/exports/{name}", s.handleDownloadExport)
+	mux.HandleFunc("GET /api/novels/{id}/chapters", s.handleTOC)
+	mux.HandleFunc("GET /api/novels/{id}/chapters/{index}", s.handleChapter)
+	mux.HandleFunc("GET /api/novels/{id}/position", s.handleGetPosition)
+	mux.HandleFunc("PUT /api/novels/{id}/position", s.handleSavePosition)
+	mux.HandleFunc("GET /opds", s.handleOPDSRoot)
+	mux.HandleFunc("GET /opds/all", s.handleOPDSAll)
+	mux.HandleFunc("GET /opds/recent", s.handleOPDSRecent)
+	mux.HandleFunc("GET /opds/sites", s.handleOPDSSites)
+	mux.HandleFunc("GET /opds/sites/{host}", s.handleOPDSSite)
+	mux.Handle("GET /", webHandler())
+	return mux
+}
+
+// Wait 等待所有任务结束
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// Submit 提交爬取任务，同一本小说已经有未结束的任务时返回错误
+func (s *Server) Submit(req JobRequest) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := newJob(fmt.Sprintf("job-%d", s.nextID+1), req, s.opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range s.order {
+		if other := s.jobs[id]; other.NovelID == job.NovelID && other.active() {
+			return nil, fmt.Errorf("%w: 小说 %s 已经有任务 %s", errJobExists, job.NovelID, other.ID)
+		}
+	}
+	s.nextID++
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+
+	s.wg.Add(1)
+	go s.runJob(job)
+	log.Printf("提交任务 %s: %s\n", job.ID, job.URL)
+	return job, nil
+}
+
+// errJobExists 同一本小说已经有未结束的任务
+var errJobExists = errors.New("任务已存在")
+
+// runJob 等待空闲的位置后执行任务，并记录任务的结果
+func (s *Server) runJob(job *Job) {
+	defer s.wg.Done()
+
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-job.stop:
+	case <-crawler.Stopped(s.ctx):
+	case <-s.ctx.Done():
+	}
+
+	s.mu.Lock()
+	if job.Status != JobQueued || isClosed(job.stop) || isClosed(crawler.Stopped(s.ctx)) || s.ctx.Err() != nil {
+		// 开始执行前已经被取消
+		job.Status = JobCanceled
+		job.FinishedTime = time.Now().Unix()
+		s.mu.Unlock()
+		return
+	}
+	job.Status = JobRunning
+	job.StartedTime = time.Now().Unix()
+	s.mu.Unlock()
+
+	err := job.run(s.ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.FinishedTime = time.Now().Unix()
+	switch {
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+		log.Printf("任务 %s 失败: %v\n", job.ID, err)
+	case isClosed(job.stop):
+		job.Status = JobCanceled
+		log.Printf("任务 %s 已取消\n", job.ID)
+	default:
+		job.Status = JobDone
+		log.Printf("任务 %s 完成\n", job.ID)
+	}
+}
+
+// Cancel 取消任务，正在爬取的章节完成后任务结束
+func (s *Server) Cancel(id string) (*JobInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[id]
+	if job == nil {
+		return nil, errJobNotFound
+	}
+	if job.active() {
+		log.Printf("取消任务 %s\n", job.ID)
+		job.cancel()
+	}
+	info := job.JobInfo
+	return &info, nil
+}
+
+// errJobNotFound 任务不存在
+var errJobNotFound = errors.New("任务不存在")
+
+// Jobs 返回所有任务的状态，按照提交顺序排列
+func (s *Server) Jobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]JobInfo, 0, len(s.order))
+	for _, id := range s.order {
+		infos = append(infos, s.jobs[id].JobInfo)
+	}
+	return infos
+}
+
+// Job 返回任务的状态
+func (s *Server) Job(id string) (JobInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[id]
+	if job == nil {
+		return JobInfo{}, false
+	}
+	return job.JobInfo, true
+}
+
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求格式错误: %v", err))
+		return
+	}
+	job, err := s.Submit(req)
+	if errors.Is(err, errJobExists) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	info, _ := s.Job(job.ID)
+	writeJSON(w, http.StatusAccepted, jobView{JobInfo: info})
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	views := []jobView{}
+	for _, info := range s.Jobs() {
+		view := jobView{JobInfo: info}
+		view.Progress, _ = loadProgress(info.NovelID, false)
+		views = append(views, view)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": views})
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.Job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errJobNotFound)
+		return
+	}
+	view := jobView{JobInfo: info}
+	view.Progress, _ = loadProgress(info.NovelID, true)
+	writeJSON(w, http.StatusOK, view)
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	info, err := s.Cancel(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobView{JobInfo: *info})
+}
+
+func (s *Server) handleListNovels(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := utils.ListWorkspaces()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	novels := []*NovelInfo{}
+	for _, ws := range workspaces {
+		if novel := novelInfo(ws, false); novel != nil {
+			novels = append(novels, novel)
+		}
+	}
+	sort.Slice(novels, func(i, j int) bool { return novels[i].ID < novels[j].ID })
+	writeJSON(w, http.StatusOK, map[string]any{"novels": novels})
+}
+
+func (s *Server) handleGetNovel(w http.ResponseWriter, r *http.Request) {
+	ws, ok := findWorkspace(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	novel := novelInfo(ws, true)
+	if novel == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("小说 %s 还没有开始爬取", ws.ID))
+		return
+	}
+	writeJSON(w, http.StatusOK, novel)
+}
+
+func (s *Server) handleListExports(w http.ResponseWriter, r *http.Request) {
+	ws, ok := findWorkspace(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	names, err := ws.ExportFiles()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"exports": names})
+}
+
+func (s *Server) handleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	ws, ok := findWorkspace(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	path, err := ws.ExportFilePath(name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("导出文件 %s 不存在", name))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(name)))
+	http.ServeFile(w, r, path)
+}
+
+// findWorkspace 根据小说标识或标题查找工作目录，找不到时返回 404。
+// 以 . 开头的标识指向页面缓存之类的隐藏目录，直接拒绝；查找时不会创建目录
+func findWorkspace(w http.ResponseWriter, key string) (*utils.Workspace, bool) {
+	if !validWorkspaceKey(key) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("无效的小说标识: %s", key))
+		return nil, false
+	}
+	ws, err := utils.LookupWorkspace(key)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	return ws, true
+}
+
+// validWorkspaceKey 检查小说标识或标题是否可以用于查找工作目录
+func validWorkspaceKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, ".") && !strings.ContainsAny(key, `/\`)
+}
+
+// novelInfo 读取工作目录中的小说信息，还没有元数据和章节清单时返回 nil
+func novelInfo(ws *utils.Workspace, withChapters bool) *NovelInfo {
+	novel := &NovelInfo{ID: ws.ID, Exports: []string{}}
+	meta, err := ws.LoadMeta()
+	if err == nil && meta != nil {
+		novel.Title = meta.Title
+		novel.Author = meta.Author
+		novel.SourceURL = meta.SourceURL
+	}
+	if progress, err := loadProgress(ws.ID, withChapters); err == nil && progress.Total > 0 {
+		novel.Progress = progress
+		if novel.Title == "" {
+			novel.Title = progress.Title
+		}
+	}
+	if meta == nil && novel.Progress == nil {
+		return nil
+	}
+	if names, err := ws.ExportFiles(); err == nil && names != nil {
+		novel.Exports = names
+	}
+	if position, err := utils.LoadReadingPosition(ws); err == nil {
+		novel.Position = position
+	}
+	return novel
+}
+
+// writeJSON 以 JSON 格式返回数据
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("返回 JSON 失败: %v\n", err)
+	}
+}
+
+// writeError 以 {"error": "..."} 格式返回错误
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// isClosed 通道是否已经关闭
+func isClosed(ch <-chan struct{}) bool {
+	if ch == nil {
+		return false
+	}
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chromedp-scraper/internal/models"
+	"chromedp-scraper/internal/utils"
+)
+
+func TestFindWorkspace(t *testing.T) {
+	root := t.TempDir()
+	utils.SetWorkspaceRoot(root)
+	t.Cleanup(func() { utils.SetWorkspaceRoot("") })
+
+	ws, err := utils.OpenWorkspace("example.com-1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SaveMeta(&models.NovelMeta{Title: "测试小说"}); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := filepath.Join(root, ".cache")
+	if err := os.MkdirAll(filepath.Join(cacheDir, "pages"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		wantID string
+	}{
+		{"小说标识", "example.com-1001", http.StatusOK, "example.com-1001"},
+		{"小说标题", "测试小说", http.StatusOK, "example.com-1001"},
+		{"不存在的小说", "example.com-9999", http.StatusNotFound, ""},
+		{"空标识", "", http.StatusBadRequest, ""},
+		{"当前目录", ".", http.StatusBadRequest, ""},
+		{"上级目录", "..", http.StatusBadRequest, ""},
+		{"页面缓存目录", ".cache", http.StatusBadRequest, ""},
+		{"隐藏目录", ".git", http.StatusBadRequest, ""},
+		{"包含斜杠", "example.com-1001/chapters", http.StatusBadRequest, ""},
+		{"包含反斜杠", `..\example.com-1001`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			got, ok := findWorkspace(rec, tt.key)
+			status := http.StatusOK
+			if !ok {
+				status = rec.Code
+			}
+			if status != tt.status {
+				t.Fatalf("findWorkspace(%q) 返回状态码 %d，期望 %d", tt.key, status, tt.status)
+			}
+			if ok && got.ID != tt.wantID {
+				t.Errorf("findWorkspace(%q) 找到 %s，期望 %s", tt.key, got.ID, tt.wantID)
+			}
+		})
+	}
+
+	// 查找工作目录不能在页面缓存目录中创建子目录
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "pages" {
+		t.Errorf("页面缓存目录中出现了其他文件: %v", entries)
+	}
+}
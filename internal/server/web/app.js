@@ -0,0 +1,208 @@
+// 小说阅读器：#/ 书架，#/novel/{id} 目录，#/novel/{id}/{index} 章节
+(function () {
+  "use strict";
+
+  var app = document.getElementById("app");
+  var crumb = document.getElementById("crumb");
+  // 当前阅读的章节，用于保存阅读进度
+  var reading = null;
+  var saveTimer = null;
+
+  function api(path, options) {
+    return fetch("api/" + path, options).then(function (resp) {
+      return resp.json().then(function (data) {
+        if (!resp.ok) {
+          throw new Error(data.error || resp.statusText);
+        }
+        return data;
+      });
+    });
+  }
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      if (key === "text") {
+        node.textContent = attrs[key];
+      } else {
+        node.setAttribute(key, attrs[key]);
+      }
+    });
+    (children || []).forEach(function (child) {
+      node.appendChild(child);
+    });
+    return node;
+  }
+
+  function render(title, nodes) {
+    crumb.textContent = "";
+    if (title) {
+      crumb.appendChild(title);
+    }
+    app.textContent = "";
+    nodes.forEach(function (node) {
+      app.appendChild(node);
+    });
+  }
+
+  function showError(err) {
+    render(null, [el("p", { class: "error", text: "出错了：" + err.message })]);
+  }
+
+  function novelPath(id) {
+    return "#/novel/" + encodeURIComponent(id);
+  }
+
+  function chapterPath(id, index) {
+    return novelPath(id) + "/" + index;
+  }
+
+  // 书架：列出已经下载的小说
+  function showNovels() {
+    api("novels").then(function (data) {
+      if (data.novels.length === 0) {
+        render(null, [el("p", { class: "muted", text: "还没有下载任何小说" })]);
+        return;
+      }
+      var list = el("ul", { class: "novels" });
+      data.novels.forEach(function (novel) {
+        var progress = novel.progress || { done: 0, total: 0 };
+        var info = (novel.author ? novel.author + " · " : "") +
+          "已下载 " + progress.done + " / " + progress.total + " 章" +
+          (progress.isCompleted ? " · 已完成" : "");
+        var item = el("li", {}, [
+          el("a", { class: "title", href: novelPath(novel.id), text: novel.title || novel.id }),
+          el("div", { class: "muted", text: info })
+        ]);
+        if (novel.position && novel.position.chapter) {
+          item.appendChild(el("a", {
+            href: chapterPath(novel.id, novel.position.chapter),
+            text: "继续阅读第 " + novel.position.chapter + " 章"
+          }));
+        }
+        list.appendChild(item);
+      });
+      render(null, [list]);
+    }).catch(showError);
+  }
+
+  // 目录：显示目录页中的所有章节，还没有下载的章节不能点击
+  function showTOC(id) {
+    Promise.all([api("novels/" + encodeURIComponent(id) + "/chapters"),
+      api("novels/" + encodeURIComponent(id) + "/position")]).then(function (results) {
+      var data = results[0];
+      var position = results[1];
+      var list = el("ul", { class: "toc" });
+      data.chapters.forEach(function (chapter) {
+        var label = chapter.title || "第 " + chapter.index + " 章";
+        var item;
+        if (chapter.available) {
+          item = el("li", {}, [el("a", { href: chapterPath(id, chapter.index), text: label })]);
+        } else {
+          item = el("li", { class: "missing", text: label + "（未下载）" });
+        }
+        if (chapter.index === position.chapter) {
+          item.className += " current";
+        }
+        list.appendChild(item);
+      });
+      var nodes = [el("h2", { text: data.title })];
+      if (position.chapter) {
+        nodes.push(el("p", {}, [el("a", {
+          href: chapterPath(id, position.chapter),
+          text: "继续阅读第 " + position.chapter + " 章"
+        })]));
+      }
+      nodes.push(list);
+      render(el("span", { text: data.title }), nodes);
+      document.title = data.title;
+    }).catch(showError);
+  }
+
+  // 章节：显示正文和上一章、下一章链接，并恢复阅读位置
+  function showChapter(id, index) {
+    var base = "novels/" + encodeURIComponent(id);
+    Promise.all([api(base + "/chapters/" + index), api(base + "/position")]).then(function (results) {
+      var chapter = results[0];
+      var position = results[1];
+      var pager = function () {
+        return el("div", { class: "pager" }, [
+          el("a", { href: chapter.prev ? chapterPath(id, chapter.prev) : "#", class: chapter.prev ? "" : "disabled", text: "上一章" }),
+          el("a", { href: novelPath(id), text: "目录" }),
+          el("a", { href: chapter.next ? chapterPath(id, chapter.next) : "#", class: chapter.next ? "" : "disabled", text: "下一章" })
+        ]);
+      };
+      var body = el("article", { class: "chapter" }, [el("h1", { text: chapter.title })]);
+      chapter.paragraphs.forEach(function (text) {
+        body.appendChild(el("p", { text: text }));
+      });
+      render(el("a", { href: novelPath(id), text: "目录" }), [pager(), body, pager()]);
+      document.title = chapter.title;
+
+      var offset = position.chapter === chapter.index ? position.offset : 0;
+      window.scrollTo(0, offset * scrollRange());
+      reading = { id: id, chapter: chapter.index };
+      savePosition();
+    }).catch(showError);
+  }
+
+  function scrollRange() {
+    return Math.max(document.documentElement.scrollHeight - window.innerHeight, 1);
+  }
+
+  // savePosition 保存当前章节和阅读的位置
+  function savePosition() {
+    if (!reading) {
+      return;
+    }
+    var body = JSON.stringify({
+      chapter: reading.chapter,
+      offset: Math.min(window.scrollY / scrollRange(), 1)
+    });
+    api("novels/" + encodeURIComponent(reading.id) + "/position", {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: body
+    }).catch(function () {});
+  }
+
+  window.addEventListener("scroll", function () {
+    clearTimeout(saveTimer);
+    saveTimer = setTimeout(savePosition, 800);
+  });
+
+  document.addEventListener("keydown", function (event) {
+    if (!reading || event.altKey || event.ctrlKey || event.metaKey) {
+      return;
+    }
+    var link = null;
+    if (event.key === "ArrowLeft") {
+      link = app.querySelector(".pager a:first-child:not(.disabled)");
+    } else if (event.key === "ArrowRight") {
+      link = app.querySelector(".pager a:last-child:not(.disabled)");
+    }
+    if (link) {
+      location.hash = link.getAttribute("href");
+    }
+  });
+
+  function route() {
+    clearTimeout(saveTimer);
+    reading = null;
+    document.title = "小说阅读";
+    var parts = location.hash.replace(/^#\/?/, "").split("/");
+    if (parts[0] === "novel" && parts[1]) {
+      var id = decodeURIComponent(parts[1]);
+      if (parts[2]) {
+        showChapter(id, parseInt(parts[2], 10));
+      } else {
+        showTOC(id);
+      }
+      return;
+    }
+    showNovels();
+  }
+
+  window.addEventListener("hashchange", route);
+  route();
+})();
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempFileMarker 临时文件名中的标记，恢复工作目录时删除遗留的临时文件
+const tempFileMarker = ".tmp-"
+
+// WriteFileAtomic 原子地写入文件：先写入同一目录下的临时文件并同步到磁盘，
+// 再重命名为目标文件，写入过程中程序被终止时目标文件保持原来的内容
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+tempFileMarker+"*")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// appendSegment 将一段内容追加到文件末尾并同步到磁盘，返回追加后的文件长度，
+// 文件不为空时先写入 separator。
+// committed 是上次确认写入完成的文件长度，文件比它长时说明上次追加没有完成，
+// 先截断多出的部分；committed 小于 0 表示长度未知，不截断
+func appendSegment(path string, committed int64, separator string, data []byte) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if committed >= 0 && size > committed {
+		log.Printf("文件 %s 末尾有 %d 字节未完成的写入，已截断\n", path, size-committed)
+		if err := f.Truncate(committed); err != nil {
+			return 0, err
+		}
+		size = committed
+	}
+	if committed > size {
+		return 0, fmt.Errorf("文件 %s 的长度 %d 小于已写入的长度 %d", path, size, committed)
+	}
+
+	if size > 0 {
+		data = append([]byte(separator), data...)
+	}
+	if _, err := f.WriteAt(data, size); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	syncDir(filepath.Dir(path))
+	return size + int64(len(data)), nil
+}
+
+// syncDir 将目录项同步到磁盘，保证重命名和新建的文件在断电后仍然存在，
+// 部分系统不支持同步目录，失败时忽略
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// isTempFile 判断是否是 WriteFileAtomic 遗留的临时文件
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempFileMarker)
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"chromedp-scraper/internal/models"
+)
+
+// saveChapterBlocks 保存章节的内容块，TXT 文件只保存纯文本，
+// 导出 EPUB、HTML 和 Markdown 时根据内容块恢复段落、小标题、图片和作者的话。
+// 章节没有内容块时删除之前保存的内容块文件
+func saveChapterBlocks(ws *Workspace, chapter *models.Chapter, num int) error {
+	path := ws.BlocksPath(num)
+	if chapter.Blocks == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(chapter.Blocks)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data, 0644)
+}
+
+// loadChapterBlocks 读取章节的内容块。内容块生成的纯文本和章节正文不一致时
+// （例如合并文件被手动修改过）不使用内容块，导出时按行拆分章节正文
+func loadChapterBlocks(ws *Workspace, chapter *models.Chapter, num int) {
+	data, err := os.ReadFile(ws.BlocksPath(num))
+	if err != nil {
+		return
+	}
+	var blocks []models.Block
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		log.Printf("读取第 %d 章的内容块失败: %v\n", num, err)
+		return
+	}
+	if models.BlocksText(blocks) != strings.TrimSpace(chapter.Content) {
+		log.Printf("第 %d 章的正文已经修改过，不使用保存的内容块\n", num)
+		return
+	}
+	chapter.Blocks = blocks
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"chromedp-scraper/internal/models"
+)
+
+// SaveImage 按照图片内容的 SHA-256 保存章节图片，内容相同的图片只保存一份，返回文件名
+func SaveImage(ws *Workspace, data []byte, ext string) (string, error) {
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + ext
+	path := filepath.Join(ws.ImagesDir(), name)
+	if _, err := os.Stat(path); err == nil {
+		return name, nil
+	}
+	if err := WriteFileAtomic(path, data, 0644); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// SavedImages 返回章节之前已经下载的图片，键为图片链接，值为文件名，
+// 重新爬取章节时不需要再次下载
+func SavedImages(ws *Workspace, num int) map[string]string {
+	images := make(map[string]string)
+	data, err := os.ReadFile(ws.BlocksPath(num))
+	if err != nil {
+		return images
+	}
+	var blocks []models.Block
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return images
+	}
+	for _, block := range blocks {
+		if block.Type != models.BlockImage || block.File == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(ws.ImagesDir(), block.File)); err == nil {
+			images[block.Src] = block.File
+		}
+	}
+	return images
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"chromedp-scraper/internal/models"
+)
+
+// libraryFile 书库文件名，保存在工作目录的根目录下
+const libraryFile = "library.json"
+
+var (
+	libraryMutex sync.Mutex // 保护书库文件的并发访问
+)
+
+// LibraryPath 返回书库文件的路径
+func LibraryPath() string {
+	return filepath.Join(workspaceRoot, libraryFile)
+}
+
+// LoadLibrary 加载书库，文件不存在时返回空书库
+func LoadLibrary() (*models.Library, error) {
+	data, err := os.ReadFile(LibraryPath())
+	if os.IsNotExist(err) {
+		return &models.Library{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var library models.Library
+	if err := json.Unmarshal(data, &library); err != nil {
+		return nil, err
+	}
+	return &library, nil
+}
+
+// SaveLibrary 保存书库
+func SaveLibrary(library *models.Library) error {
+	if err := os.MkdirAll(workspaceRoot, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(library, "", "    ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(LibraryPath(), data, 0644)
+}
+
+// UpdateLibrary 加载书库，调用 update 修改后保存，update 返回错误时不保存
+func UpdateLibrary(update func(library *models.Library) error) error {
+	libraryMutex.Lock()
+	defer libraryMutex.Unlock()
+
+	library, err := LoadLibrary()
+	if err != nil {
+		return err
+	}
+	if err := update(library); err != nil {
+		return err
+	}
+	return SaveLibrary(library)
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrWorkspaceLocked 工作目录正在被其他任务使用
+var ErrWorkspaceLocked = errors.New("工作目录正在被其他任务使用")
+
+const (
+	// lockFile 工作目录的锁文件
+	lockFile = ".lock"
+	// lockRefreshInterval 持有锁期间更新锁文件修改时间的间隔
+	lockRefreshInterval = 30 * time.Second
+	// lockStaleAfter 锁文件超过这个时间没有更新，说明持有锁的进程已经异常退出
+	lockStaleAfter = 2 * time.Minute
+)
+
+var (
+	locksMutex sync.Mutex
+	// 本进程持有锁的工作目录
+	heldLocks = make(map[string]bool)
+)
+
+// lockKey 上下文中记录已经持有的工作目录锁
+type lockKey struct {
+	dir string
+}
+
+// LockWorkspace 获取工作目录的锁，保证同一时间只有一个任务爬取或修改同一本小说，
+// 锁已经被其他任务持有时立即返回 ErrWorkspaceLocked。
+// 返回的上下文记录了已经持有的锁，使用它再次获取同一个工作目录的锁时直接成功，
+// 调用 unlock 释放锁
+func LockWorkspace(ctx context.Context, ws *Workspace) (context.Context, func(), error) {
+	key := lockKey{dir: ws.Dir}
+	if ctx.Value(key) != nil {
+		return ctx, func() {}, nil
+	}
+
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	if heldLocks[ws.Dir] {
+		return nil, nil, fmt.Errorf("%w: %s", ErrWorkspaceLocked, ws.Dir)
+	}
+	path := ws.path(lockFile)
+	if err := createLockFile(path); err != nil {
+		return nil, nil, err
+	}
+	heldLocks[ws.Dir] = true
+
+	// 定期更新锁文件的修改时间，其他进程据此判断锁是否过期
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+
+	var once sync.Once
+	unlock := func() {
+		once.Do(func() {
+			close(done)
+			locksMutex.Lock()
+			defer locksMutex.Unlock()
+			if err := os.Remove(path); err != nil {
+				log.Printf("删除锁文件 %s 失败: %v\n", path, err)
+			}
+			delete(heldLocks, ws.Dir)
+		})
+	}
+	return context.WithValue(ctx, key, true), unlock, nil
+}
+
+// createLockFile 创建锁文件，已经存在且没有过期时返回 ErrWorkspaceLocked
+func createLockFile(path string) error {
+	for retry := 0; retry < 2; retry++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "pid %d\n%s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+			return f.Close()
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("创建锁文件失败: %v", err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) < lockStaleAfter {
+			holder, _ := os.ReadFile(path)
+			return fmt.Errorf("%w: %s（%s）", ErrWorkspaceLocked, path, firstLine(holder))
+		}
+		log.Printf("锁文件 %s 已经过期，删除后重新获取\n", path)
+		os.Remove(path)
+	}
+	return fmt.Errorf("%w: %s", ErrWorkspaceLocked, path)
+}
+
+// firstLine 返回内容的第一行
+func firstLine(data []byte) string {
+	for i, b := range data {
+		if b == '\n' {
+			return string(data[:i])
+		}
+	}
+	return string(data)
+}
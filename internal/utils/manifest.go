@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"chromedp-scraper/internal/models"
+)
+
+var (
+	manifestMutex sync.Mutex // 保护章节清单的并发访问
+)
+
+// legacyProgress 旧版本的进度文件，只记录最后爬取的章节
+type legacyProgress struct {
+	Title string `json:"title"`
+	// 最后爬取的章节编号
+	LastChapterNum int `json:"lastChapter"`
+	// 最后爬取章节的下一章链接
+	LastChapterURL string `json:"lastChapterUrl"`
+	// 已按顺序合并到的章节编号
+	MergedChapterNum int   `json:"mergedChapter"`
+	IsCompleted      bool  `json:"isCompleted"`
+	LastUpdateTime   int64 `json:"lastUpdateTime"`
+}
+
+// LoadManifest 加载章节清单，文件不存在时返回空清单。
+// 只有旧版本进度文件的工作目录会转换为章节清单
+func LoadManifest(ws *Workspace) (*models.Manifest, error) {
+	data, err := os.ReadFile(ws.ManifestPath())
+	if os.IsNotExist(err) {
+		return loadLegacyProgress(ws)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest models.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// loadLegacyProgress 将旧版本的进度文件转换为章节清单，
+// 最后爬取的章节记录为已完成，并保留其下一章链接用于继续爬取
+func loadLegacyProgress(ws *Workspace) (*models.Manifest, error) {
+	manifest := &models.Manifest{}
+
+	data, err := os.ReadFile(ws.path(legacyProgressFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var progress legacyProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, err
+	}
+
+	manifest.Title = progress.Title
+	manifest.Mode = models.ModeFollow
+	manifest.MergedChapterNum = progress.MergedChapterNum
+	manifest.IsCompleted = progress.IsCompleted
+	manifest.LastUpdateTime = progress.LastUpdateTime
+	if progress.LastChapterNum > 0 {
+		record := manifest.Record(progress.LastChapterNum)
+		record.Status = models.ChapterDone
+		record.NextURL = progress.LastChapterURL
+		record.UpdatedTime = progress.LastUpdateTime
+	}
+	return manifest, nil
+}
+
+// SaveManifest 保存章节清单
+func SaveManifest(ws *Workspace, manifest *models.Manifest) error {
+	sort.Slice(manifest.Chapters, func(i, j int) bool {
+		return manifest.Chapters[i].Index < manifest.Chapters[j].Index
+	})
+	manifest.LastUpdateTime = time.Now().Unix()
+
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(ws.ManifestPath(), data, 0644)
+}
+
+// UpdateManifest 加载章节清单，调用 update 修改后保存
+func UpdateManifest(ws *Workspace, update func(manifest *models.Manifest)) error {
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+
+	manifest, err := LoadManifest(ws)
+	if err != nil {
+		return err
+	}
+	update(manifest)
+	return SaveManifest(ws, manifest)
+}
+
+// MarkChapterDone 记录章节已经爬取并保存
+func MarkChapterDone(ws *Workspace, index int, url string, chapter *models.Chapter) error {
+	body := chapterBody(chapter)
+	return UpdateManifest(ws, func(manifest *models.Manifest) {
+		record := manifest.Record(index)
+		record.Title = chapter.Title
+		record.URL = url
+		record.NextURL = chapter.NextLink
+		record.Status = models.ChapterDone
+		record.Attempts++
+		record.LastError = ""
+		setContent(record, body)
+	})
+}
+
+// setContent 记录章节正文的哈希和字节数
+func setContent(record *models.ChapterRecord, body string) {
+	hash := sha256.Sum256([]byte(body))
+	record.ContentHash = hex.EncodeToString(hash[:])
+	record.ByteLength = len(body)
+	record.UpdatedTime = time.Now().Unix()
+}
+
+// MarkChapterFailed 记录章节爬取或保存失败
+func MarkChapterFailed(ws *Workspace, index int, url string, chapterErr error) error {
+	return UpdateManifest(ws, func(manifest *models.Manifest) {
+		record := manifest.Record(index)
+		record.URL = url
+		record.Status = models.ChapterFailed
+		record.Attempts++
+		record.LastError = chapterErr.Error()
+		record.UpdatedTime = time.Now().Unix()
+	})
+}
+
+// SetMergedChapterNum 更新已合并到的章节编号和合并文件中已经写入完成的字节数
+func SetMergedChapterNum(ws *Workspace, title string, chapterNum int, mergedBytes int64) error {
+	return UpdateManifest(ws, func(manifest *models.Manifest) {
+		if manifest.Title == "" {
+			manifest.Title = title
+		}
+		manifest.MergedChapterNum = chapterNum
+		manifest.MergedBytes = mergedBytes
+	})
+}
+
+// ChapterSaved 检查章节是否已经保存，已完成的章节需要已合并或者章节文件仍然存在
+func ChapterSaved(ws *Workspace, manifest *models.Manifest, index int) bool {
+	record := manifest.Chapter(index)
+	if record == nil || record.Status != models.ChapterDone {
+		return false
+	}
+	if index <= manifest.MergedChapterNum {
+		if _, err := os.Stat(ws.MergedFilePath(manifest.Title)); err == nil {
+			return true
+		}
+	}
+	_, err := os.Stat(ws.ChapterPath(index))
+	return err == nil
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"chromedp-scraper/internal/models"
+)
+
+// readingFile 阅读进度文件
+const readingFile = "reading.json"
+
+// LoadChapter 读取已经保存的章节，章节还没有合并时读取章节文件，否则从合并文件中查找
+func LoadChapter(ws *Workspace, title string, index int) (*models.Chapter, error) {
+	if chapterTitle, body, ok := readChapterFile(ws.ChapterPath(index), index); ok {
+		return &models.Chapter{Title: chapterTitle, Content: body}, nil
+	}
+
+	data, err := os.ReadFile(ws.MergedFilePath(title))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取合并文件失败: %v", err)
+	}
+	var found *models.Chapter
+	splitMergedFile(data, loadManifestOrNil(ws), func(i int, chapter *models.Chapter) bool {
+		if i == index {
+			found = chapter
+			return false
+		}
+		return true
+	})
+	if found == nil {
+		return nil, fmt.Errorf("第 %d 章还没有下载", index)
+	}
+	return found, nil
+}
+
+// LoadReadingPosition 读取小说的阅读进度，还没有阅读过时返回 nil
+func LoadReadingPosition(ws *Workspace) (*models.ReadingPosition, error) {
+	data, err := os.ReadFile(ws.path(readingFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var position models.ReadingPosition
+	if err := json.Unmarshal(data, &position); err != nil {
+		return nil, err
+	}
+	return &position, nil
+}
+
+// SaveReadingPosition 保存小说的阅读进度
+func SaveReadingPosition(ws *Workspace, position *models.ReadingPosition) error {
+	position.UpdatedTime = time.Now().Unix()
+	data, err := json.MarshalIndent(position, "", "    ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(ws.path(readingFile), data, 0644)
+}
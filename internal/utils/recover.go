@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"chromedp-scraper/internal/models"
+)
+
+// RecoverWorkspace 检查并修复工作目录中因为程序中断而没有写完的文件：
+// 删除遗留的临时文件，截断合并文件末尾没有完成的追加，删除不完整的章节文件，
+// 并同步章节清单，文件已经丢失的章节重新标记为等待爬取。
+// 应该在开始爬取或者合并之前调用
+func RecoverWorkspace(ws *Workspace) error {
+	for _, dir := range []string{ws.Dir, ws.path(chaptersDir), ws.path(blocksDir), ws.path(imagesDir), ws.path(exportsDir)} {
+		removeTempFiles(dir)
+	}
+
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+
+	manifest, err := LoadManifest(ws)
+	if err != nil {
+		// 章节清单损坏时保留原文件，根据章节文件和合并文件重新生成
+		broken := ws.ManifestPath() + ".broken"
+		log.Printf("章节清单损坏，重新生成，原文件保存为 %s: %v\n", broken, err)
+		if err := os.Rename(ws.ManifestPath(), broken); err != nil {
+			return fmt.Errorf("备份章节清单失败: %v", err)
+		}
+		if manifest, err = LoadManifest(ws); err != nil {
+			return err
+		}
+	}
+	if manifest.Title == "" {
+		if meta, err := ws.LoadMeta(); err == nil && meta != nil {
+			manifest.Title = meta.Title
+		}
+	}
+
+	changed := false
+	if manifest.Title != "" {
+		if changed, err = recoverMergedFile(ws, manifest); err != nil {
+			return err
+		}
+	}
+
+	chapterFiles, err := listChapterFiles(ws)
+	if err != nil {
+		return err
+	}
+	for index, file := range chapterFiles {
+		title, body, ok := readChapterFile(file, index)
+		if !ok {
+			log.Printf("章节文件 %s 不完整，已删除\n", file)
+			if err := os.Remove(file); err != nil {
+				return fmt.Errorf("删除章节文件失败: %v", err)
+			}
+			delete(chapterFiles, index)
+			continue
+		}
+		// 章节文件已经保存，但是章节清单还没有更新
+		if record := manifest.Record(index); record.Status != models.ChapterDone {
+			log.Printf("章节 %d 已经保存，更新章节清单\n", index)
+			record.Title = title
+			record.Status = models.ChapterDone
+			record.LastError = ""
+			setContent(record, body)
+			changed = true
+		}
+	}
+
+	// 已完成但是没有合并、章节文件也不存在的章节需要重新爬取
+	for _, record := range manifest.Chapters {
+		if record.Status != models.ChapterDone || record.Index <= manifest.MergedChapterNum {
+			continue
+		}
+		if _, ok := chapterFiles[record.Index]; !ok {
+			log.Printf("章节 %d 的文件已经丢失，重新标记为等待爬取\n", record.Index)
+			record.Status = models.ChapterPending
+			manifest.IsCompleted = false
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return SaveManifest(ws, manifest)
+}
+
+// recoverMergedFile 根据章节清单中记录的合并文件长度修复合并文件，返回章节清单是否有变化
+func recoverMergedFile(ws *Workspace, manifest *models.Manifest) (bool, error) {
+	path := ws.MergedFilePath(manifest.Title)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if manifest.MergedChapterNum == 0 {
+			return false, nil
+		}
+		log.Printf("合并文件 %s 不存在，已合并的 %d 个章节需要重新爬取\n", path, manifest.MergedChapterNum)
+		manifest.MergedChapterNum = 0
+		manifest.MergedBytes = 0
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	size := info.Size()
+	switch {
+	case manifest.MergedChapterNum == 0:
+		return false, nil
+	case manifest.MergedBytes == 0:
+		// 旧版本没有记录合并文件的长度，以当前文件为准
+		manifest.MergedBytes = size
+		return true, nil
+	case size > manifest.MergedBytes:
+		log.Printf("合并文件 %s 末尾有 %d 字节未完成的写入，已截断\n", path, size-manifest.MergedBytes)
+		return false, os.Truncate(path, manifest.MergedBytes)
+	case size < manifest.MergedBytes:
+		return true, truncateToLastChapter(path, manifest)
+	}
+	return false, nil
+}
+
+// truncateToLastChapter 合并文件比记录的长度短时，最后一个章节可能不完整，
+// 截断到最后一个章节标题之前，并更新已合并到的章节序号
+func truncateToLastChapter(path string, manifest *models.Manifest) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lastIndex, lastOffset := 0, 0
+	headings := newChapterHeadings(manifest)
+	prevBlank := true
+	offset := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if prevBlank {
+			if index, _, ok := headings.match(string(trimmed)); ok {
+				lastIndex = index
+				lastOffset = offset
+			}
+		}
+		prevBlank = len(bytes.TrimSpace(line)) == 0
+		offset += len(line)
+	}
+
+	// 章节之间使用两个换行分隔
+	size := int64(max(lastOffset-2, 0))
+	merged := max(lastIndex-1, 0)
+	log.Printf("合并文件 %s 不完整，截断到第 %d 章\n", path, merged)
+	if err := os.Truncate(path, size); err != nil {
+		return err
+	}
+	manifest.MergedChapterNum = merged
+	manifest.MergedBytes = size
+	return nil
+}
+
+// readChapterFile 读取 SaveChapter 保存的章节文件，检查标题行中的序号和文件结尾，
+// 返回章节标题和正文
+func readChapterFile(path string, index int) (string, string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.HasSuffix(data, []byte("\n")) {
+		return "", "", false
+	}
+	heading, body, _ := bytes.Cut(data, []byte("\n"))
+	m := chapterHeadingPattern.FindSubmatch(heading)
+	if m == nil || string(m[1]) != strconv.Itoa(index) {
+		return "", "", false
+	}
+	return string(m[2]), string(bytes.TrimSpace(body)), true
+}
+
+// removeTempFiles 删除目录中 WriteFileAtomic 遗留的临时文件
+func removeTempFiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isTempFile(entry.Name()) {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		log.Printf("删除未写完的临时文件 %s\n", file)
+		if err := os.Remove(file); err != nil {
+			log.Printf("删除文件 %s 失败: %v\n", file, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"chromedp-scraper/internal/models"
+)
+
+// saveDoneChapter 保存章节文件并在章节清单中标记为已完成，和爬取时的顺序一致
+func saveDoneChapter(t *testing.T, ws *Workspace, index int, content string) {
+	t.Helper()
+	chapter := &models.Chapter{Title: fmt.Sprintf("标题%d", index), Content: content}
+	if err := SaveChapter(ws, chapter, index); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkChapterDone(ws, index, fmt.Sprintf("https://example.com/%d.html", index), chapter); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mergeDoneChapters 保存并合并序号为 1 到 n 的章节
+func mergeDoneChapters(t *testing.T, ws *Workspace, n int) {
+	t.Helper()
+	for index := 1; index <= n; index++ {
+		saveDoneChapter(t, ws, index, fmt.Sprintf("第 %d 章的正文", index))
+	}
+	if _, err := MergeChapterFiles(ws, 1, "book", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// changeMergedFile 修改合并文件，模拟程序中断时留下的文件
+func changeMergedFile(t *testing.T, ws *Workspace, change func(data []byte) []byte) {
+	t.Helper()
+	path := ws.MergedFilePath("book")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, change(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverWorkspace(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, ws *Workspace)
+
+		wantMerged    int
+		wantHeadings  []int
+		wantRemaining []int
+		// 恢复后等待重新爬取的章节
+		wantPending []int
+	}{
+		{
+			name: "截断合并文件末尾没有完成的追加",
+			setup: func(t *testing.T, ws *Workspace) {
+				mergeDoneChapters(t, ws, 3)
+				changeMergedFile(t, ws, func(data []byte) []byte {
+					return append(data, "\n\n第4章 标题4\n\n只写了一半"...)
+				})
+			},
+			wantMerged:   3,
+			wantHeadings: []int{1, 2, 3},
+		},
+		{
+			name: "合并文件比记录的短时截断到最后一个完整的章节",
+			setup: func(t *testing.T, ws *Workspace) {
+				mergeDoneChapters(t, ws, 3)
+				changeMergedFile(t, ws, func(data []byte) []byte { return data[:len(data)-3] })
+			},
+			wantMerged:   2,
+			wantHeadings: []int{1, 2},
+			wantPending:  []int{3},
+		},
+		{
+			name: "截断时不把正文中的章节名当作标题行",
+			setup: func(t *testing.T, ws *Workspace) {
+				saveDoneChapter(t, ws, 1, "第 1 章的正文")
+				saveDoneChapter(t, ws, 2, "第 2 章的正文")
+				saveDoneChapter(t, ws, 3, "他想起了\n\n第4章 回忆\n\n里的内容，这是第 3 章的正文")
+				if _, err := MergeChapterFiles(ws, 1, "book", 1); err != nil {
+					t.Fatal(err)
+				}
+				changeMergedFile(t, ws, func(data []byte) []byte { return data[:len(data)-3] })
+			},
+			wantMerged:   2,
+			wantHeadings: []int{1, 2},
+			wantPending:  []int{3},
+		},
+		{
+			name: "删除不完整的章节文件",
+			setup: func(t *testing.T, ws *Workspace) {
+				mergeDoneChapters(t, ws, 2)
+				saveDoneChapter(t, ws, 3, "第 3 章的正文")
+				if err := os.WriteFile(ws.ChapterPath(3), []byte("第3章 标题3\n\n只写了"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantMerged:   2,
+			wantHeadings: []int{1, 2},
+			wantPending:  []int{3},
+		},
+		{
+			name: "章节文件已保存但清单没有更新",
+			setup: func(t *testing.T, ws *Workspace) {
+				mergeDoneChapters(t, ws, 2)
+				saveTestChapters(t, ws, 3)
+			},
+			wantMerged:    2,
+			wantHeadings:  []int{1, 2},
+			wantRemaining: []int{3},
+		},
+		{
+			name: "删除遗留的临时文件",
+			setup: func(t *testing.T, ws *Workspace) {
+				mergeDoneChapters(t, ws, 2)
+				tmp := filepath.Join(filepath.Dir(ws.ChapterPath(3)), ".chapter_0003.txt"+tempFileMarker+"123")
+				if err := os.WriteFile(tmp, []byte("第3章"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantMerged:   2,
+			wantHeadings: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWorkspace(t)
+			tt.setup(t, ws)
+
+			if err := RecoverWorkspace(ws); err != nil {
+				t.Fatal(err)
+			}
+
+			manifest, err := LoadManifest(ws)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.MergedChapterNum != tt.wantMerged {
+				t.Errorf("已合并到第 %d 章，期望第 %d 章", manifest.MergedChapterNum, tt.wantMerged)
+			}
+			if info, err := os.Stat(ws.MergedFilePath("book")); err != nil || info.Size() != manifest.MergedBytes {
+				t.Errorf("合并文件的长度和记录的 %d 字节不一致: %v", manifest.MergedBytes, err)
+			}
+			if got := mergedHeadings(t, ws); !reflect.DeepEqual(got, tt.wantHeadings) {
+				t.Errorf("合并文件中的章节为 %v，期望 %v", got, tt.wantHeadings)
+			}
+			if got := chapterFileIndexes(t, ws); !reflect.DeepEqual(got, tt.wantRemaining) {
+				t.Errorf("剩余的章节文件为 %v，期望 %v", got, tt.wantRemaining)
+			}
+			var pending []int
+			for _, record := range manifest.Chapters {
+				if record.Status == models.ChapterPending {
+					pending = append(pending, record.Index)
+				} else if record.Status != models.ChapterDone {
+					t.Errorf("第 %d 章的状态为 %s", record.Index, record.Status)
+				}
+			}
+			if !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("等待重新爬取的章节为 %v，期望 %v", pending, tt.wantPending)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(ws.ChapterPath(1))); len(entries) != len(tt.wantRemaining) {
+				t.Errorf("章节目录中有 %d 个文件，期望 %d 个", len(entries), len(tt.wantRemaining))
+			}
+		})
+	}
+}
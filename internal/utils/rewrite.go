@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"chromedp-scraper/internal/models"
+)
+
+// StoredChapter 工作目录中已经保存的章节
+type StoredChapter struct {
+	Index   int
+	Chapter *models.Chapter
+}
+
+// LoadStoredChapters 读取合并文件和章节文件中所有已经保存的章节，按章节序号排序
+func LoadStoredChapters(ws *Workspace, title string) ([]StoredChapter, error) {
+	data, err := os.ReadFile(ws.MergedFilePath(title))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取合并文件失败: %v", err)
+	}
+	var chapters []StoredChapter
+	splitMergedFile(data, loadManifestOrNil(ws), func(index int, chapter *models.Chapter) bool {
+		chapters = append(chapters, StoredChapter{Index: index, Chapter: chapter})
+		return true
+	})
+
+	chapterFiles, err := listChapterFiles(ws)
+	if err != nil {
+		return nil, err
+	}
+	for index, path := range chapterFiles {
+		if chapterTitle, body, ok := readChapterFile(path, index); ok {
+			chapters = append(chapters, StoredChapter{Index: index, Chapter: &models.Chapter{Title: chapterTitle, Content: body}})
+		}
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Index < chapters[j].Index })
+	return chapters, nil
+}
+
+// RewriteStoredChapters 依次对每个已经保存的章节调用 rewrite，章节中带有保存的内容块，rewrite 修改章节后返回 true，
+// 修改过的章节会写回内容块文件和章节文件或合并文件，并更新章节清单中的内容哈希和合并文件长度，
+// 返回修改的章节数。调用前需要锁定工作目录
+func RewriteStoredChapters(ws *Workspace, title string, rewrite func(index int, chapter *models.Chapter) bool) (int, error) {
+	changed := make(map[int]string)
+	mergedBytes := int64(-1)
+
+	// 先拆分合并文件，拆分结果不完整时整体重写会丢失内容，这时不修改任何文件
+	path := ws.MergedFilePath(title)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("读取合并文件失败: %v", err)
+	}
+	manifest := loadManifestOrNil(ws)
+	var merged []StoredChapter
+	leading := splitMergedFile(data, manifest, func(index int, chapter *models.Chapter) bool {
+		merged = append(merged, StoredChapter{Index: index, Chapter: chapter})
+		return true
+	})
+	if len(data) > 0 {
+		if err := checkMergedChapters(manifest, leading, merged); err != nil {
+			return 0, fmt.Errorf("合并文件 %s 无法完整拆分，没有重写: %v", path, err)
+		}
+	}
+
+	// 章节文件逐个重写
+	chapterFiles, err := listChapterFiles(ws)
+	if err != nil {
+		return 0, err
+	}
+	for index, path := range chapterFiles {
+		chapterTitle, body, ok := readChapterFile(path, index)
+		if !ok {
+			continue
+		}
+		chapter := &models.Chapter{Title: chapterTitle, Content: body}
+		loadChapterBlocks(ws, chapter, index)
+		if !rewrite(index, chapter) {
+			continue
+		}
+		if err := saveChapterBlocks(ws, chapter, index); err != nil {
+			return 0, fmt.Errorf("保存第 %d 章的内容块失败: %v", index, err)
+		}
+		if err := WriteFileAtomic(path, []byte(chapterText(index, chapter)), 0644); err != nil {
+			return 0, fmt.Errorf("保存章节文件 %s 失败: %v", path, err)
+		}
+		changed[index] = chapterBody(chapter)
+	}
+
+	// 合并文件按照 MergeChapterFiles 的格式整体重写
+	var parts []string
+	mergedChanged := false
+	for _, stored := range merged {
+		index, chapter := stored.Index, stored.Chapter
+		loadChapterBlocks(ws, chapter, index)
+		if rewrite(index, chapter) {
+			if err := saveChapterBlocks(ws, chapter, index); err != nil {
+				return 0, fmt.Errorf("保存第 %d 章的内容块失败: %v", index, err)
+			}
+			changed[index] = chapterBody(chapter)
+			mergedChanged = true
+		}
+		parts = append(parts, chapterText(index, chapter))
+	}
+	if mergedChanged {
+		text := strings.Join(parts, "\n\n")
+		if err := WriteFileAtomic(path, []byte(text), 0644); err != nil {
+			return 0, fmt.Errorf("保存合并文件失败: %v", err)
+		}
+		mergedBytes = int64(len(text))
+		log.Printf("已重写合并文件 %s\n", path)
+	}
+
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	err = UpdateManifest(ws, func(manifest *models.Manifest) {
+		for index, body := range changed {
+			if record := manifest.Chapter(index); record != nil {
+				setContent(record, body)
+			}
+		}
+		if mergedBytes >= 0 {
+			manifest.MergedBytes = mergedBytes
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("更新章节清单失败: %v", err)
+	}
+	return len(changed), nil
+}
+
+// checkMergedChapters 检查从合并文件中拆分出的章节是否覆盖了整个文件，
+// 并且和章节清单中记录的已合并章节一致
+func checkMergedChapters(manifest *models.Manifest, leading string, merged []StoredChapter) error {
+	if leading != "" {
+		return fmt.Errorf("第一个章节之前有无法识别的内容")
+	}
+	if manifest == nil || manifest.MergedChapterNum == 0 {
+		return nil
+	}
+	if len(merged) == 0 {
+		return fmt.Errorf("没有找到章节，章节清单中已合并到第 %d 章", manifest.MergedChapterNum)
+	}
+	last := merged[len(merged)-1].Index
+	if last != manifest.MergedChapterNum {
+		return fmt.Errorf("最后一章是第 %d 章，章节清单中已合并到第 %d 章", last, manifest.MergedChapterNum)
+	}
+	if coversMergedChapters(manifest) {
+		if want := manifest.MergedChapterNum - manifest.FirstIndex() + 1; len(merged) != want {
+			return fmt.Errorf("拆分出 %d 章，章节清单中记录了 %d 章", len(merged), want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"chromedp-scraper/internal/models"
+)
+
+func TestRewriteStoredChapters(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(data []byte) []byte
+
+		wantErr      bool
+		wantHeadings []int
+	}{
+		{
+			name:         "重写所有已合并的章节",
+			wantHeadings: []int{1, 2, 3},
+		},
+		{
+			name: "第一个章节之前有无法识别的内容时不重写",
+			change: func(data []byte) []byte {
+				return append([]byte("书名：测试\n\n"), data...)
+			},
+			wantErr:      true,
+			wantHeadings: []int{1, 2, 3},
+		},
+		{
+			name: "拆分出的章节和章节清单不一致时不重写",
+			change: func(data []byte) []byte {
+				return bytes.Replace(data, []byte("第3章 标题3"), []byte("第3章 别的标题"), 1)
+			},
+			wantErr:      true,
+			wantHeadings: []int{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWorkspace(t)
+			mergeDoneChapters(t, ws, 3)
+			if tt.change != nil {
+				changeMergedFile(t, ws, tt.change)
+			}
+			before, err := os.ReadFile(ws.MergedFilePath("book"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := RewriteStoredChapters(ws, "book", func(index int, chapter *models.Chapter) bool {
+				chapter.Content += "。"
+				return true
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("重写返回 %v，期望出错: %v", err, tt.wantErr)
+			}
+			after, err := os.ReadFile(ws.MergedFilePath("book"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr {
+				if n != 0 || !bytes.Equal(before, after) {
+					t.Errorf("出错时重写了 %d 章，合并文件被修改", n)
+				}
+			} else if n != len(tt.wantHeadings) {
+				t.Errorf("重写了 %d 章，期望 %d 章", n, len(tt.wantHeadings))
+			}
+			if got := mergedHeadings(t, ws); !reflect.DeepEqual(got, tt.wantHeadings) {
+				t.Errorf("合并文件中的章节为 %v，期望 %v", got, tt.wantHeadings)
+			}
+		})
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"chromedp-scraper/internal/models"
@@ -24,16 +26,15 @@ func ToString(v any) string {
 	return string(bytes)
 }
 
-// SaveChapter 保存章节内容到文件
-func SaveChapter(chapter *models.Chapter, num int) error {
-	// 清理章节内容中的固定文本
-	cleanContent := strings.ReplaceAll(chapter.Content, "本章未完，点击下一页继续阅读上一页书页目录下一页", "")
-	cleanContent = strings.TrimSpace(cleanContent) // 移除可能产生的多余空行
+// SaveChapter 保存章节内容到工作目录的章节文件
+func SaveChapter(ws *Workspace, chapter *models.Chapter, num int) error {
+	filename := ws.ChapterPath(num)
 
-	content := fmt.Sprintf("第%d章 %s\n\n%s\n", num, chapter.Title, cleanContent)
-	filename := fmt.Sprintf("chapter_%04d.txt", num)
-
-	err := os.WriteFile(filename, []byte(content), 0644)
+	// 先保存内容块，章节文件存在时内容块一定已经保存
+	if err := saveChapterBlocks(ws, chapter, num); err != nil {
+		return fmt.Errorf("failed to save chapter blocks: %v", err)
+	}
+	err := WriteFileAtomic(filename, []byte(chapterText(num, chapter)), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to save chapter: %v", err)
 	}
@@ -42,6 +43,16 @@ func SaveChapter(chapter *models.Chapter, num int) error {
 	return nil
 }
 
+// chapterText 返回章节文件的内容：标题行、空行和正文，合并文件由章节文件的内容以空行连接而成
+func chapterText(num int, chapter *models.Chapter) string {
+	return fmt.Sprintf("第%d章 %s\n\n%s\n", num, chapter.Title, chapterBody(chapter))
+}
+
+// chapterBody 返回保存到章节文件中的正文，正文在爬取时已经按照网站的清理规则清理过
+func chapterBody(chapter *models.Chapter) string {
+	return strings.TrimSpace(chapter.Content)
+}
+
 // 常用浏览器 User-Agent 列表
 var userAgents = []string{
 	// Chrome for Windows
@@ -189,67 +200,275 @@ func MergeChaptersToFile(catalog *models.Catalog, filePath string) error {
 
 	// 4. 将合并后的内容写入文件
 	// 0644 表示文件权限：所有者可读写，其他用户可读
-	return os.WriteFile(filePath, []byte(contentBuilder.String()), 0644)
+	return WriteFileAtomic(filePath, []byte(contentBuilder.String()), 0644)
+}
+
+// MergeResult 章节合并结果
+type MergeResult struct {
+	// 本次合并的章节数
+	Merged int
+	// 已合并到的章节序号
+	MergedUpTo int
+	// 已合并章节之后缺失的章节序号，缺失章节之后的章节文件暂不合并
+	Missing []int
 }
 
-// MergeChapterFiles 合并章节文件
-func MergeChapterFiles(batchSize int, title string) error {
-	// 获取所有章节文件
-	files, err := filepath.Glob("chapter_????.txt")
+// MergeChapterFiles 按章节序号顺序合并工作目录中的章节文件。
+// 只合并紧接在已合并章节之后的连续章节，遇到缺失的章节就停止，
+// 缺失章节之后的章节文件保留到缺失章节补齐后再合并。
+// firstIndex 是还没有合并过任何章节时期望的第一个章节序号，磁盘上有序号更小的
+// 章节文件时从序号最小的章节开始合并；只有合并文件中已经记录的章节才会被当作重复删除。
+// 连续章节数量不足 batchSize 时不合并
+func MergeChapterFiles(ws *Workspace, batchSize int, title string, firstIndex int) (*MergeResult, error) {
+	// 获取所有章节文件及其序号
+	chapterFiles, err := listChapterFiles(ws)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 对文件名进行排序
-	sort.Strings(files)
+	// 定义合并文件的固定名称
+	mergedFilename := ws.MergedFilePath(title)
 
-	// 如果文件数量不足batchSize，直接返回
-	if len(files) < batchSize {
-		return nil
+	// 确定已合并到的章节序号
+	manifest, err := LoadManifest(ws)
+	if err != nil {
+		return nil, err
 	}
-
-	// 创建合并文件的目录
-	mergedDir := "merged"
-	if err := os.MkdirAll(mergedDir, 0755); err != nil {
-		return err
+	// 合并文件存在时才认为清单中记录的章节已经合并
+	merged := 0
+	// 合并文件中已经确认写入完成的字节数，-1 表示未知
+	committed := int64(-1)
+	if _, err := os.Stat(mergedFilename); err == nil && manifest.MergedChapterNum > 0 {
+		merged = manifest.MergedChapterNum
+		if manifest.MergedBytes > 0 {
+			committed = manifest.MergedBytes
+		}
+	} else if os.IsNotExist(err) {
+		committed = 0
 	}
 
-	// 定义合并文件的固定名称
-	mergedFilename := filepath.Join(mergedDir, fmt.Sprintf("20020908120445-%s.txt", title))
-	var allContents []string
-
-	// 如果合并文件已存在，先读取其内容
-	if _, err := os.Stat(mergedFilename); err == nil {
-		content, err := os.ReadFile(mergedFilename)
-		if err != nil {
-			return fmt.Errorf("读取已有合并文件失败: %v", err)
+	var indexes []int
+	for index := range chapterFiles {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	// 还没有合并过任何章节时，从期望的第一个章节和磁盘上最小的章节中较小的一个开始
+	mergedUpTo := merged
+	if merged == 0 {
+		mergedUpTo = firstIndex - 1
+		if len(indexes) > 0 && indexes[0] <= mergedUpTo {
+			mergedUpTo = indexes[0] - 1
 		}
-		allContents = append(allContents, string(content))
+	}
+	result := &MergeResult{MergedUpTo: merged}
+
+	// 删除已经合并过的重复章节文件，收集紧接着的连续章节
+	var files []string
+	prev := mergedUpTo
+	for _, index := range indexes {
+		file := chapterFiles[index]
+		if index <= merged {
+			log.Printf("章节 %d 已经合并过，删除重复的章节文件 %s\n", index, file)
+			if err := os.Remove(file); err != nil {
+				log.Printf("删除文件 %s 失败: %v\n", file, err)
+			}
+			continue
+		}
+		// 记录缺失的章节
+		for missing := prev + 1; missing < index; missing++ {
+			result.Missing = append(result.Missing, missing)
+		}
+		if len(result.Missing) == 0 {
+			files = append(files, file)
+		}
+		prev = index
+	}
+	if len(result.Missing) > 0 {
+		log.Printf("缺失章节 %v，之后的章节暂不合并\n", result.Missing)
+	}
+
+	// 如果连续章节数量不足batchSize，直接返回
+	if len(files) == 0 || len(files) < batchSize {
+		return result, nil
 	}
 
-	// 读取所有新章节文件的内容
+	// 按顺序读取所有新章节文件的内容
+	var allContents []string
 	for _, file := range files {
 		content, err := os.ReadFile(file)
 		if err != nil {
-			log.Printf("读取文件 %s 失败: %v\n", file, err)
-			continue
+			return nil, fmt.Errorf("读取文件 %s 失败: %v", file, err)
 		}
 		allContents = append(allContents, string(content))
 	}
 
-	// 合并所有内容并写入文件
-	mergedContent := strings.Join(allContents, "\n\n")
-	if err := os.WriteFile(mergedFilename, []byte(mergedContent), 0644); err != nil {
-		return fmt.Errorf("保存合并文件失败: %v", err)
+	// 将新章节作为一段追加到合并文件末尾，已合并的内容不再重写
+	segment := strings.Join(allContents, "\n\n")
+	mergedBytes, err := appendSegment(mergedFilename, committed, "\n\n", []byte(segment))
+	if err != nil {
+		return nil, fmt.Errorf("保存合并文件失败: %v", err)
+	}
+
+	// 追加完成后才记录已合并到的章节序号，之前中断时多出的内容会在下次合并时截断
+	result.Merged = len(files)
+	result.MergedUpTo = mergedUpTo + len(files)
+	if err := SetMergedChapterNum(ws, title, result.MergedUpTo, mergedBytes); err != nil {
+		return nil, fmt.Errorf("更新合并进度失败: %v", err)
 	}
 
-	// 删除已合并的章节文件
+	// 章节清单更新后再删除已合并的章节文件
 	for _, file := range files {
 		if err := os.Remove(file); err != nil {
 			log.Printf("删除文件 %s 失败: %v\n", file, err)
 		}
 	}
 
-	log.Printf("成功合并文件 %s\n", mergedFilename)
-	return nil
+	log.Printf("成功合并文件 %s，已合并到第 %d 章\n", mergedFilename, result.MergedUpTo)
+	return result, nil
+}
+
+// listChapterFiles 返回工作目录中所有章节文件，键为章节序号
+func listChapterFiles(ws *Workspace) (map[int]string, error) {
+	files, err := filepath.Glob(ws.chapterGlob())
+	if err != nil {
+		return nil, err
+	}
+
+	chapterFiles := make(map[int]string, len(files))
+	for _, file := range files {
+		var index int
+		if _, err := fmt.Sscanf(filepath.Base(file), "chapter_%d.txt", &index); err != nil {
+			continue
+		}
+		chapterFiles[index] = file
+	}
+	return chapterFiles, nil
+}
+
+// chapterHeadingPattern 匹配 SaveChapter 写入的章节标题行
+var chapterHeadingPattern = regexp.MustCompile(`^第(\d+)章 (.*)$`)
+
+// chapterHeadings 识别合并文件中的章节标题行。合并文件中的章节序号是连续的，
+// 只有序号是下一章的行才是标题行，章节清单记录了合并文件中的每个章节时，
+// 标题还需要和记录一致，正文中以"第N章"开头的段落不会被当作新的章节
+type chapterHeadings struct {
+	// 用于核对标题的章节清单，为 nil 时只检查章节序号
+	manifest *models.Manifest
+	// 下一个章节的序号，0 表示还没有遇到第一个章节
+	next int
+}
+
+// newChapterHeadings 创建标题行识别器。旧版本转换的章节清单和重新生成的章节清单
+// 只有部分章节的记录，这时只检查章节序号
+func newChapterHeadings(manifest *models.Manifest) *chapterHeadings {
+	if manifest == nil || !coversMergedChapters(manifest) {
+		return &chapterHeadings{}
+	}
+	return &chapterHeadings{manifest: manifest}
+}
+
+// coversMergedChapters 检查章节清单是否记录了已合并的每个章节及其标题
+func coversMergedChapters(manifest *models.Manifest) bool {
+	first := manifest.FirstIndex()
+	if manifest.MergedChapterNum == 0 || first == 0 || first > manifest.MergedChapterNum {
+		return false
+	}
+	for index := first; index <= manifest.MergedChapterNum; index++ {
+		if record := manifest.Chapter(index); record == nil || record.Title == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// match 判断一行是否是下一个章节的标题行，返回章节序号和标题
+func (h *chapterHeadings) match(line string) (int, string, bool) {
+	m := chapterHeadingPattern.FindStringSubmatch(line)
+	if m == nil {
+		return 0, "", false
+	}
+	index, err := strconv.Atoi(m[1])
+	if err != nil || (h.next > 0 && index != h.next) {
+		return 0, "", false
+	}
+	title := strings.TrimSpace(m[2])
+	if h.manifest != nil {
+		// 合并文件不是从章节清单中的第一个章节开始时，清单没有覆盖合并文件，只检查序号
+		if h.next == 0 && index != h.manifest.FirstIndex() {
+			h.manifest = nil
+		} else if record := h.manifest.Chapter(index); record == nil || strings.TrimSpace(record.Title) != title {
+			return 0, "", false
+		}
+	}
+	h.next = index + 1
+	return index, title, true
+}
+
+// LoadMergedNovel 读取工作目录中小说的合并文件，按照章节标题行拆分为章节，并读取每个章节的内容块
+func LoadMergedNovel(ws *Workspace, title string) (*models.Novel, error) {
+	data, err := os.ReadFile(ws.MergedFilePath(title))
+	if err != nil {
+		return nil, fmt.Errorf("读取合并文件失败: %v", err)
+	}
+
+	novel := &models.Novel{Title: title}
+	splitMergedFile(data, loadManifestOrNil(ws), func(index int, chapter *models.Chapter) bool {
+		loadChapterBlocks(ws, chapter, index)
+		novel.Chapters = append(novel.Chapters, chapter)
+		return true
+	})
+	return novel, nil
+}
+
+// splitMergedFile 按照章节标题行拆分合并文件，依次对每个章节调用 fn，fn 返回 false 时停止。
+// manifest 用于确认标题行，为 nil 时只检查章节序号是否连续。返回第一个章节标题行之前无法识别的内容
+func splitMergedFile(data []byte, manifest *models.Manifest, fn func(index int, chapter *models.Chapter) bool) string {
+	headings := newChapterHeadings(manifest)
+	var chapter *models.Chapter
+	var index int
+	var lines, leading []string
+	flush := func() bool {
+		if chapter == nil {
+			return true
+		}
+		chapter.Content = strings.TrimSpace(strings.Join(lines, "\n"))
+		lines = nil
+		return fn(index, chapter)
+	}
+
+	prevBlank := true
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		// 章节标题行出现在文件开头或空行之后
+		if prevBlank {
+			if i, chapterTitle, ok := headings.match(line); ok {
+				if !flush() {
+					return strings.TrimSpace(strings.Join(leading, "\n"))
+				}
+				index = i
+				chapter = &models.Chapter{Title: chapterTitle}
+				prevBlank = false
+				continue
+			}
+		}
+		if chapter != nil {
+			lines = append(lines, line)
+		} else {
+			leading = append(leading, line)
+		}
+		prevBlank = strings.TrimSpace(line) == ""
+	}
+	flush()
+	return strings.TrimSpace(strings.Join(leading, "\n"))
+}
+
+// loadManifestOrNil 读取章节清单，用于拆分合并文件，读取失败时返回 nil
+func loadManifestOrNil(ws *Workspace) *models.Manifest {
+	manifest, err := LoadManifest(ws)
+	if err != nil {
+		log.Printf("读取章节清单失败: %v\n", err)
+		return nil
+	}
+	return manifest
 }
@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"chromedp-scraper/internal/models"
+)
+
+// newTestWorkspace 在临时目录中创建工作目录，测试结束后恢复原来的根目录
+func newTestWorkspace(t *testing.T) *Workspace {
+	t.Helper()
+	root := workspaceRoot
+	SetWorkspaceRoot(t.TempDir())
+	t.Cleanup(func() { SetWorkspaceRoot(root) })
+
+	ws, err := OpenWorkspace("book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+// saveTestChapters 保存指定序号的章节文件
+func saveTestChapters(t *testing.T, ws *Workspace, indexes ...int) {
+	t.Helper()
+	for _, index := range indexes {
+		chapter := &models.Chapter{
+			Title:   fmt.Sprintf("标题%d", index),
+			Content: fmt.Sprintf("第 %d 章的正文", index),
+		}
+		if err := SaveChapter(ws, chapter, index); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// mergedHeadings 返回合并文件中的章节标题序号
+func mergedHeadings(t *testing.T, ws *Workspace) []int {
+	t.Helper()
+	data, err := os.ReadFile(ws.MergedFilePath("book"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []int
+	for _, m := range regexp.MustCompile(`(?m)^第(\d+)章 `).FindAllStringSubmatch(string(data), -1) {
+		var index int
+		fmt.Sscanf(m[1], "%d", &index)
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// chapterFileIndexes 返回磁盘上剩余的章节文件序号
+func chapterFileIndexes(t *testing.T, ws *Workspace) []int {
+	t.Helper()
+	files, err := listChapterFiles(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []int
+	for index := 1; index <= 20; index++ {
+		if _, ok := files[index]; ok {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+func TestMergeChapterFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		// 第一次合并前保存并合并的章节
+		merged []int
+		// 之后保存的章节
+		saved      []int
+		batchSize  int
+		firstIndex int
+
+		wantMerged    int
+		wantUpTo      int
+		wantMissing   []int
+		wantHeadings  []int
+		wantRemaining []int
+	}{
+		{
+			name:          "继续爬取时不删除还没有合并的章节",
+			saved:         []int{1, 2, 3, 4, 5},
+			batchSize:     10,
+			firstIndex:    6,
+			wantUpTo:      0,
+			wantRemaining: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:         "从磁盘上最小的章节开始合并",
+			saved:        []int{1, 2, 3, 4, 5},
+			batchSize:    1,
+			firstIndex:   6,
+			wantMerged:   5,
+			wantUpTo:     5,
+			wantHeadings: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:         "从指定的起始章节开始合并",
+			saved:        []int{6, 7},
+			batchSize:    1,
+			firstIndex:   6,
+			wantMerged:   2,
+			wantUpTo:     7,
+			wantHeadings: []int{6, 7},
+		},
+		{
+			name:          "缺少第一个章节时不合并",
+			saved:         []int{2, 3},
+			batchSize:     1,
+			firstIndex:    1,
+			wantMissing:   []int{1},
+			wantRemaining: []int{2, 3},
+		},
+		{
+			name:          "缺失章节之后的章节暂不合并",
+			merged:        []int{1, 2},
+			saved:         []int{3, 5},
+			batchSize:     1,
+			firstIndex:    1,
+			wantMerged:    1,
+			wantUpTo:      3,
+			wantMissing:   []int{4},
+			wantHeadings:  []int{1, 2, 3},
+			wantRemaining: []int{5},
+		},
+		{
+			name:         "删除已经合并过的重复章节文件",
+			merged:       []int{1, 2, 3},
+			saved:        []int{3, 4},
+			batchSize:    1,
+			firstIndex:   1,
+			wantMerged:   1,
+			wantUpTo:     4,
+			wantHeadings: []int{1, 2, 3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWorkspace(t)
+			if len(tt.merged) > 0 {
+				saveTestChapters(t, ws, tt.merged...)
+				if _, err := MergeChapterFiles(ws, 1, "book", tt.merged[0]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			saveTestChapters(t, ws, tt.saved...)
+
+			result, err := MergeChapterFiles(ws, tt.batchSize, "book", tt.firstIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Merged != tt.wantMerged || result.MergedUpTo != tt.wantUpTo {
+				t.Errorf("合并了 %d 章，已合并到第 %d 章，期望合并 %d 章，已合并到第 %d 章",
+					result.Merged, result.MergedUpTo, tt.wantMerged, tt.wantUpTo)
+			}
+			if !reflect.DeepEqual(result.Missing, tt.wantMissing) {
+				t.Errorf("缺失章节为 %v，期望 %v", result.Missing, tt.wantMissing)
+			}
+			if got := mergedHeadings(t, ws); !reflect.DeepEqual(got, tt.wantHeadings) {
+				t.Errorf("合并文件中的章节为 %v，期望 %v", got, tt.wantHeadings)
+			}
+			if got := chapterFileIndexes(t, ws); !reflect.DeepEqual(got, tt.wantRemaining) {
+				t.Errorf("剩余的章节文件为 %v，期望 %v", got, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestSplitMergedFile(t *testing.T) {
+	manifest := &models.Manifest{MergedChapterNum: 2, Chapters: []*models.ChapterRecord{
+		{Index: 1, Title: "标题1", Status: models.ChapterDone},
+		{Index: 2, Title: "标题2", Status: models.ChapterDone},
+	}}
+	tests := []struct {
+		name     string
+		data     string
+		manifest *models.Manifest
+		want     []string
+	}{
+		{
+			name: "正常的合并文件",
+			data: "第1章 标题1\n\n正文一\n\n第2章 标题2\n\n正文二\n",
+			want: []string{"1 标题1: 正文一", "2 标题2: 正文二"},
+		},
+		{
+			name: "正文中序号不连续的章节名",
+			data: "第1章 标题1\n\n正文一\n\n第12章 回忆\n\n正文一续\n\n第2章 标题2\n\n正文二\n",
+			want: []string{"1 标题1: 正文一\n\n第12章 回忆\n\n正文一续", "2 标题2: 正文二"},
+		},
+		{
+			name:     "正文中序号是下一章但标题不同",
+			data:     "第1章 标题1\n\n正文一\n\n第2章 回忆\n\n正文一续\n\n第2章 标题2\n\n正文二\n",
+			manifest: manifest,
+			want:     []string{"1 标题1: 正文一\n\n第2章 回忆\n\n正文一续", "2 标题2: 正文二"},
+		},
+		{
+			name: "旧版本转换的清单只检查序号",
+			data: "第1章 标题1\n\n正文一\n\n第2章 标题2\n\n正文二\n",
+			manifest: &models.Manifest{MergedChapterNum: 2, Chapters: []*models.ChapterRecord{
+				{Index: 2, Status: models.ChapterDone},
+			}},
+			want: []string{"1 标题1: 正文一", "2 标题2: 正文二"},
+		},
+		{
+			name: "标题行前面没有空行",
+			data: "第1章 标题1\n\n正文一\n第2章 标题2\n",
+			want: []string{"1 标题1: 正文一\n第2章 标题2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			splitMergedFile([]byte(tt.data), tt.manifest, func(index int, chapter *models.Chapter) bool {
+				got = append(got, fmt.Sprintf("%d %s: %s", index, chapter.Title, chapter.Content))
+				return true
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("拆分结果为 %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// legacyMergedFile 旧版本保存的三章合并文件
+const legacyMergedFile = "第1章 标题1\n\n第 1 章的正文\n\n第2章 标题2\n\n第 2 章的正文\n\n第3章 标题3\n\n第 3 章的正文\n"
+
+// TestPartialManifests 旧版本转换的章节清单和重新生成的章节清单只有部分章节的记录，
+// 读取、继续合并和重写合并文件时都不能丢失章节
+func TestPartialManifests(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, ws *Workspace)
+		// 重写的章节数，包括还没有合并的章节文件
+		wantRewritten int
+	}{
+		{
+			name: "旧版本的 progress.json",
+			setup: func(t *testing.T, ws *Workspace) {
+				if err := os.WriteFile(ws.MergedFilePath("book"), []byte(legacyMergedFile), 0644); err != nil {
+					t.Fatal(err)
+				}
+				progress := `{"title":"book","lastChapter":3,"mergedChapter":3}`
+				if err := os.WriteFile(ws.path(legacyProgressFile), []byte(progress), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRewritten: 3,
+		},
+		{
+			name: "损坏后重新生成的章节清单",
+			setup: func(t *testing.T, ws *Workspace) {
+				// 还没有合并的第 4 章在重新生成的清单中有记录，已合并的章节没有
+				mergeDoneChapters(t, ws, 3)
+				saveDoneChapter(t, ws, 4, "第 4 章的正文")
+				if err := os.WriteFile(ws.ManifestPath(), []byte("{"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := ws.SaveMeta(&models.NovelMeta{Title: "book"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := RecoverWorkspace(ws); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRewritten: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWorkspace(t)
+			tt.setup(t, ws)
+
+			novel, err := LoadMergedNovel(ws, "book")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(novel.Chapters) != 3 {
+				t.Errorf("读取到 %d 章，期望 3 章", len(novel.Chapters))
+			}
+
+			n, err := RewriteStoredChapters(ws, "book", func(index int, chapter *models.Chapter) bool {
+				chapter.Content += "。"
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.wantRewritten {
+				t.Errorf("重写了 %d 章，期望 %d 章", n, tt.wantRewritten)
+			}
+			if got := mergedHeadings(t, ws); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+				t.Errorf("重写后合并文件中的章节为 %v，期望 [1 2 3]", got)
+			}
+
+			saveTestChapters(t, ws, 4)
+			if _, err := MergeChapterFiles(ws, 1, "book", 4); err != nil {
+				t.Fatal(err)
+			}
+			if got := mergedHeadings(t, ws); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+				t.Errorf("继续合并后合并文件中的章节为 %v，期望 [1 2 3 4]", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"chromedp-scraper/internal/models"
+)
+
+// watermarkFile 水印规则文件名，保存在工作目录的根目录下
+const watermarkFile = "watermarks.json"
+
+var (
+	watermarkMutex sync.Mutex // 保护水印规则文件的并发访问
+)
+
+// WatermarksPath 返回水印规则文件的路径
+func WatermarksPath() string {
+	return filepath.Join(workspaceRoot, watermarkFile)
+}
+
+// LoadWatermarks 加载水印规则，文件不存在时返回空规则
+func LoadWatermarks() (*models.Watermarks, error) {
+	data, err := os.ReadFile(WatermarksPath())
+	if os.IsNotExist(err) {
+		return &models.Watermarks{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var watermarks models.Watermarks
+	if err := json.Unmarshal(data, &watermarks); err != nil {
+		return nil, err
+	}
+	return &watermarks, nil
+}
+
+// UpdateWatermarks 加载水印规则，调用 update 修改后保存
+func UpdateWatermarks(update func(watermarks *models.Watermarks)) error {
+	watermarkMutex.Lock()
+	defer watermarkMutex.Unlock()
+
+	watermarks, err := LoadWatermarks()
+	if err != nil {
+		return err
+	}
+	update(watermarks)
+
+	if err := os.MkdirAll(workspaceRoot, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(watermarks, "", "    ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(WatermarksPath(), data, 0644)
+}
@@ -0,0 +1,306 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chromedp-scraper/internal/models"
+)
+
+// DefaultWorkspaceRoot 默认的工作目录根目录
+const DefaultWorkspaceRoot = "novels"
+
+const (
+	metaFile     = "meta.json"
+	manifestFile = "manifest.json"
+	chaptersDir  = "chapters"
+	blocksDir    = "blocks"
+	imagesDir    = "images"
+	exportsDir   = "exports"
+
+	// legacyProgressFile 旧版本只记录最后章节序号的进度文件
+	legacyProgressFile = "progress.json"
+
+	// pageCacheDir 页面缓存目录，位于根目录下
+	pageCacheDir = ".cache/pages"
+)
+
+// workspaceRoot 所有小说工作目录的根目录
+var workspaceRoot = DefaultWorkspaceRoot
+
+// SetWorkspaceRoot 设置工作目录的根目录
+func SetWorkspaceRoot(dir string) {
+	if dir == "" {
+		dir = DefaultWorkspaceRoot
+	}
+	workspaceRoot = dir
+}
+
+// PageCacheDir 返回页面缓存的目录
+func PageCacheDir() string {
+	return filepath.Join(workspaceRoot, filepath.FromSlash(pageCacheDir))
+}
+
+// Workspace 小说的工作目录，保存章节、章节清单、元数据和导出文件，
+// 目录结构为 <根目录>/<小说标识>/{meta.json,manifest.json,chapters/,blocks/,images/,exports/}
+type Workspace struct {
+	// 小说标识
+	ID string
+	// 工作目录路径
+	Dir string
+}
+
+// OpenWorkspace 打开小说的工作目录，不存在时创建
+func OpenWorkspace(novelID string) (*Workspace, error) {
+	if novelID == "" {
+		return nil, fmt.Errorf("小说标识不能为空")
+	}
+	ws := &Workspace{
+		ID:  novelID,
+		Dir: filepath.Join(workspaceRoot, novelID),
+	}
+	for _, dir := range []string{ws.Dir, ws.path(chaptersDir), ws.path(blocksDir), ws.path(imagesDir), ws.path(exportsDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建工作目录失败: %v", err)
+		}
+	}
+	return ws, nil
+}
+
+// GetNovelIdentifier 从URL中提取小说标识，由网站域名和小说ID组成，
+// 例如 https://www.drxsw.com/book/3570239/1944073676.html 得到 www.drxsw.com-3570239
+func GetNovelIdentifier(url string) string {
+	// 移除协议部分
+	url = strings.TrimPrefix(url, "http://")
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.SplitN(url, "?", 2)[0]
+	url = strings.SplitN(url, "#", 2)[0]
+
+	// 提取域名和小说ID
+	parts := strings.Split(url, "/")
+	if len(parts) >= 4 && parts[1] == "book" {
+		// 网站域名和小说ID，例如: www.drxsw.com-3570239
+		return sanitizeFilename(parts[0] + "-" + parts[2])
+	}
+
+	// 其他网站使用路径中第一个以数字开头的部分，例如 /chapter/12865.html 得到 12865
+	for _, part := range parts[1:] {
+		if bookID := leadingDigits(part); bookID != "" {
+			return sanitizeFilename(parts[0] + "-" + bookID)
+		}
+	}
+
+	// 找不到数字ID时使用整个路径
+	return sanitizeFilename(strings.Trim(strings.Join(parts, "-"), "-"))
+}
+
+// leadingDigits 返回字符串开头的连续数字
+func leadingDigits(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
+
+// OpenWorkspaceForURL 根据小说的目录页或章节链接打开工作目录
+func OpenWorkspaceForURL(url string) (*Workspace, error) {
+	return OpenWorkspace(GetNovelIdentifier(url))
+}
+
+// FindWorkspace 根据小说标识或标题查找已有的工作目录，并创建缺少的子目录
+func FindWorkspace(key string) (*Workspace, error) {
+	ws, err := LookupWorkspace(key)
+	if err != nil {
+		return nil, err
+	}
+	return OpenWorkspace(ws.ID)
+}
+
+// LookupWorkspace 根据小说标识或标题查找已有的工作目录，只读取，不创建任何目录。
+// 以 . 开头的是页面缓存之类的隐藏目录，不是小说的工作目录
+func LookupWorkspace(key string) (*Workspace, error) {
+	if key != "" && !strings.HasPrefix(key, ".") && !strings.ContainsAny(key, `/\`) {
+		dir := filepath.Join(workspaceRoot, key)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return &Workspace{ID: key, Dir: dir}, nil
+		}
+	}
+
+	workspaces, err := ListWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, ws := range workspaces {
+		if meta, err := ws.LoadMeta(); err == nil && meta != nil && meta.Title == key {
+			return ws, nil
+		}
+	}
+	return nil, fmt.Errorf("未找到小说《%s》的工作目录", key)
+}
+
+// ListWorkspaces 列出根目录下所有的工作目录
+func ListWorkspaces() ([]*Workspace, error) {
+	entries, err := os.ReadDir(workspaceRoot)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaces []*Workspace
+	for _, entry := range entries {
+		// 跳过页面缓存之类的隐藏目录
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			workspaces = append(workspaces, &Workspace{
+				ID:  entry.Name(),
+				Dir: filepath.Join(workspaceRoot, entry.Name()),
+			})
+		}
+	}
+	return workspaces, nil
+}
+
+// path 返回工作目录下的路径
+func (ws *Workspace) path(elem ...string) string {
+	return filepath.Join(append([]string{ws.Dir}, elem...)...)
+}
+
+// ChapterPath 返回章节文件的路径
+func (ws *Workspace) ChapterPath(num int) string {
+	return ws.path(chaptersDir, fmt.Sprintf("chapter_%04d.txt", num))
+}
+
+// BlocksPath 返回章节内容块文件的路径，章节合并后内容块文件仍然保留
+func (ws *Workspace) BlocksPath(num int) string {
+	return ws.path(blocksDir, fmt.Sprintf("chapter_%04d.json", num))
+}
+
+// ImagesDir 返回章节图片所在的目录
+func (ws *Workspace) ImagesDir() string {
+	return ws.path(imagesDir)
+}
+
+// chapterGlob 返回匹配所有章节文件的模式
+func (ws *Workspace) chapterGlob() string {
+	return ws.path(chaptersDir, "chapter_*.txt")
+}
+
+// ManifestPath 返回章节清单文件的路径
+func (ws *Workspace) ManifestPath() string {
+	return ws.path(manifestFile)
+}
+
+// ExportPath 返回导出文件的路径，ext 为扩展名，例如 ".txt"
+func (ws *Workspace) ExportPath(title, ext string) string {
+	return ws.path(exportsDir, sanitizeFilename(title)+ext)
+}
+
+// MergedFilePath 返回合并文件的路径
+func (ws *Workspace) MergedFilePath(title string) string {
+	return ws.ExportPath(title, ".txt")
+}
+
+// EPUBFilePath 返回 EPUB 文件的路径
+func (ws *Workspace) EPUBFilePath(title string) string {
+	return ws.ExportPath(title, ".epub")
+}
+
+// HTMLFilePath 返回 HTML 文件的路径
+func (ws *Workspace) HTMLFilePath(title string) string {
+	return ws.ExportPath(title, ".html")
+}
+
+// MarkdownFilePath 返回 Markdown 文件的路径
+func (ws *Workspace) MarkdownFilePath(title string) string {
+	return ws.ExportPath(title, ".md")
+}
+
+// ExportFiles 返回导出目录中的文件名，不包括临时文件
+func (ws *Workspace) ExportFiles() ([]string, error) {
+	entries, err := os.ReadDir(ws.path(exportsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !isTempFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// ExportFilePath 返回导出目录中指定文件的路径，文件名不能包含目录
+func (ws *Workspace) ExportFilePath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." || isTempFile(name) {
+		return "", fmt.Errorf("无效的文件名: %s", name)
+	}
+	return ws.path(exportsDir, name), nil
+}
+
+// LoadMeta 读取小说元数据，文件不存在时返回 nil
+func (ws *Workspace) LoadMeta() (*models.NovelMeta, error) {
+	data, err := os.ReadFile(ws.path(metaFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta models.NovelMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// SaveMeta 保存小说元数据，只覆盖非空的字段
+func (ws *Workspace) SaveMeta(meta *models.NovelMeta) error {
+	existing, err := ws.LoadMeta()
+	if err != nil || existing == nil {
+		existing = &models.NovelMeta{CreatedTime: time.Now().Unix()}
+	}
+
+	existing.ID = ws.ID
+	if meta.Title != "" && meta.Title != "未命名" {
+		existing.Title = meta.Title
+	}
+	if meta.Author != "" && meta.Author != "未知" {
+		existing.Author = meta.Author
+	}
+	if meta.SourceURL != "" {
+		existing.SourceURL = meta.SourceURL
+	}
+	existing.LastUpdateTime = time.Now().Unix()
+
+	data, err := json.MarshalIndent(existing, "", "    ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(ws.path(metaFile), data, 0644)
+}
+
+// sanitizeFilename 去掉文件名中不允许出现的字符
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		return "未命名"
+	}
+	return name
+}
@@ -2,299 +2,684 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
-	"math/rand"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"chromedp-scraper/internal/config"
+	"chromedp-scraper/internal/crawler"
+	"chromedp-scraper/internal/fetcher"
 	"chromedp-scraper/internal/models"
 	"chromedp-scraper/internal/scraper"
+	"chromedp-scraper/internal/server"
 	"chromedp-scraper/internal/utils"
-
-	"github.com/chromedp/chromedp"
 )
 
+const usageText = `用法: chromedp-scraper <命令> [参数]
+
+命令:
+  catalog <目录页URL>        根据目录页并发爬取所有章节
+  follow <起始章节URL>       从起始章节开始，沿下一章链接顺序爬取
+  resume <小说标识|标题>     根据章节清单爬取缺失或失败的章节
+  update <小说标识|标题>     检查并只下载新发布的章节，追加到已有的导出文件
+  merge <小说标识|标题>      合并工作目录中已保存的章节文件
+  export <小说标识|标题>     将合并文件导出为 EPUB（-format html|md 导出为 HTML 或 Markdown）
+  library add <URL>          将小说加入书库
+  library remove <小说标识|标题|URL>
+                             从书库中移除小说
+  library list               列出书库中的小说
+  library update             检查书库中所有小说的新章节
+  daemon                     后台运行，按照检查间隔定期更新书库中的小说
+  serve                      启动本地 HTTP 接口和网页阅读器
+  sites list                 列出已配置的网站
+  watermark detect [小说标识|标题]
+                             检测反复出现的疑似水印行，不指定小说时检测所有小说
+  watermark apply [小说标识|标题]
+                             学习检测到的水印，从已保存的章节中删除并重新导出
+  watermark list             列出学习到的水印规则
+  cache stats                查看页面缓存的统计信息
+  cache clear                清空页面缓存，-type 只清空一种页面
+
+使用 "chromedp-scraper <命令> -h" 查看命令参数
+`
+
 func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usageText)
+		os.Exit(2)
+	}
 
-	shouldReturn := LoadNovelFromCategoryChapterLink()
-	if shouldReturn != nil {
-		log.Fatal(shouldReturn)
+	// 第一次收到退出信号时不再开始新的章节，等待正在爬取的章节完成后退出，
+	// 再次收到退出信号时立即取消
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan struct{})
+	ctx = crawler.WithStop(ctx, stop)
+	go handleSignals(stop, cancel)
+
+	var err error
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "catalog":
+		err = runCatalog(ctx, args)
+	case "follow":
+		err = runFollow(ctx, args)
+	case "resume":
+		err = runResume(ctx, args)
+	case "update":
+		err = runUpdate(ctx, args)
+	case "merge":
+		err = runMerge(args)
+	case "export":
+		err = runExport(args)
+	case "library":
+		err = runLibrary(ctx, args)
+	case "daemon":
+		err = runDaemon(ctx, args)
+	case "serve":
+		err = runServe(ctx, args)
+	case "sites":
+		err = runSites(args)
+	case "watermark":
+		err = runWatermark(ctx, args)
+	case "cache":
+		err = runCache(args)
+	case "help", "-h", "--help":
+		fmt.Print(usageText)
 		return
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n%s", cmd, usageText)
+		os.Exit(2)
 	}
 
-	// shouldReturn2 := LoadNovelFromFirstChapterLink()
-	// if shouldReturn2 {
-	// 	return
-	// }
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-// LoadNovelFromCategoryChapterLink 根据目录页，首先统计出来目录页的所有章节的链接，然后再
-// 抓取每个章节的内容，最后将结果保存到文件中，这样爬取章节内容的时候，可以并发爬取
-func LoadNovelFromCategoryChapterLink() error {
+// handleSignals 处理 SIGINT 和 SIGTERM
+func handleSignals(stop chan struct{}, cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	// 获取目录页URL
-	catalogURL := "https://www.dxmwx.org/chapter/12865.html" // 设置默认值，也可以从命令行参数获取
+	<-signals
+	log.Println("收到退出信号，等待正在爬取的章节完成，再次按 Ctrl+C 立即退出")
+	close(stop)
 
-	// 设置 Chrome 选项
-	opts := utils.GetChromeOptions()
+	<-signals
+	log.Println("再次收到退出信号，立即退出")
+	cancel()
+}
 
-	// 检查 Chrome 安装
-	if !utils.CheckChromeInstalled() {
-		return fmt.Errorf("请先安装 Chrome 浏览器")
+// commonFlags 各命令共用的参数
+type commonFlags struct {
+	rootDir    string
+	configPath string
+	recordDir  string
+	replayDir  string
+	noCache    bool
+	cacheTTLs  map[string]time.Duration
+	opts       crawler.Options
+}
+
+// newFlagSet 创建带有公共参数的命令参数集
+func newFlagSet(name, argsUsage string) (*flag.FlagSet, *commonFlags) {
+	c := &commonFlags{opts: crawler.DefaultOptions(), cacheTTLs: make(map[string]time.Duration)}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: chromedp-scraper %s [参数] %s\n\n参数:\n", name, argsUsage)
+		fs.PrintDefaults()
 	}
+	fs.StringVar(&c.rootDir, "root", utils.DefaultWorkspaceRoot, "小说工作目录的根目录")
+	fs.StringVar(&c.configPath, "config", "", "网站配置文件路径（默认自动查找 configs/sites.json）")
+	fs.IntVar(&c.opts.WorkerCount, "workers", c.opts.WorkerCount, "同时爬取的章节数")
+	fs.IntVar(&c.opts.BatchSize, "batch", c.opts.BatchSize, "每批处理的章节数")
+	fs.IntVar(&c.opts.StartChapter, "start", c.opts.StartChapter, "起始章节序号")
+	fs.IntVar(&c.opts.EndChapter, "end", c.opts.EndChapter, "结束章节序号，0 表示不限制")
+	fs.IntVar(&c.opts.TabMaxUses, "tab-uses", c.opts.TabMaxUses, "每个浏览器 tab 最多导航的次数，超过后重新创建")
+	fs.BoolVar(&c.opts.EPUB, "epub", c.opts.EPUB, "爬取完成后导出 EPUB")
+	fs.StringVar(&c.opts.CoverPath, "cover", "", "EPUB 封面图片路径")
+	fs.StringVar(&c.recordDir, "record", "", "把抓取的每个页面记录到这个目录")
+	fs.StringVar(&c.replayDir, "replay", "", "从这个目录回放记录的页面，不访问网络")
+	fs.BoolVar(&c.noCache, "no-cache", false, "不使用页面缓存")
+	fs.BoolVar(&c.opts.NoImages, "no-images", false, "不下载章节中的图片")
+	c.cacheTTLs[fetcher.PageCatalog] = 30 * time.Minute
+	c.cacheTTLs[fetcher.PageChapter] = 0
+	fs.Func("cache-catalog-ttl", "目录页的缓存有效期，0 表示永不过期（默认 30m0s）", c.ttlFlag(fetcher.PageCatalog))
+	fs.Func("cache-chapter-ttl", "章节页的缓存有效期，0 表示永不过期（默认 0）", c.ttlFlag(fetcher.PageChapter))
+	return fs, c
+}
 
-	// 创建上下文
-	rootCtx := context.Background()
-	allocCtx, allocCancel := chromedp.NewExecAllocator(rootCtx, opts...)
-	defer allocCancel()
+// ttlFlag 解析页面类型的缓存有效期
+func (c *commonFlags) ttlFlag(pageType string) func(string) error {
+	return func(value string) error {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		c.cacheTTLs[pageType] = ttl
+		return nil
+	}
+}
 
-	browserCtx, browserCancel := chromedp.NewContext(
-		allocCtx,
-		chromedp.WithLogf(log.Printf),
-	)
-	defer browserCancel()
+// apply 使公共参数生效
+func (c *commonFlags) apply() error {
+	if c.configPath != "" {
+		if err := config.ReloadConfig(c.configPath); err != nil {
+			return fmt.Errorf("加载网站配置 %s 失败: %v", c.configPath, err)
+		}
+		log.Printf("成功从 %s 加载网站配置\n", c.configPath)
+	}
+	utils.SetWorkspaceRoot(c.rootDir)
 
-	ctx, cancel := context.WithTimeout(browserCtx, 24*time.Hour)
-	defer cancel()
+	if c.recordDir != "" && c.replayDir != "" {
+		return fmt.Errorf("-record 和 -replay 不能同时使用")
+	}
+	if c.replayDir != "" {
+		return fetcher.EnableReplay(c.replayDir)
+	}
+	// 回放时页面都来自记录的目录，不需要缓存
+	if !c.noCache {
+		fetcher.EnableCache(utils.PageCacheDir(), c.cacheTTLs)
+	}
+	if c.recordDir != "" {
+		return fetcher.EnableRecord(c.recordDir)
+	}
+	return nil
+}
+
+// parseArgs 解析参数，允许参数和位置参数交替出现，返回位置参数
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseCommand 解析命令参数，并要求恰好一个位置参数
+func parseCommand(fs *flag.FlagSet, c *commonFlags, args []string) (string, error) {
+	positional := parseArgs(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return positional[0], c.apply()
+}
 
-	// 抓取目录
-	catalog, err := scraper.ScrapeCatalog(ctx, catalogURL)
+func runCatalog(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("catalog", "<目录页URL>")
+	catalogURL, err := parseCommand(fs, c, args)
 	if err != nil {
-		return fmt.Errorf("获取目录失败: %v", err)
+		return err
 	}
+	return crawler.LoadNovelFromCategoryChapterLink(ctx, catalogURL, c.opts)
+}
 
-	for _, ch := range catalog.Chapters {
-		log.Printf("Index: %d, Title: %s", ch.Index, ch.Title)
+func runFollow(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("follow", "<起始章节URL>")
+	firstChapterURL, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
 	}
+	return crawler.LoadNovelFromFirstChapterLink(ctx, firstChapterURL, c.opts)
+}
 
-	// 创建工作池
-	workerCount := 1 // 同时爬取的章节数
-	batchSize := 10  // 每批处理的章节数
-	totalChapters := len(catalog.Chapters)
+func runResume(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("resume", "<小说标识|标题>")
+	key, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
+	}
+	return crawler.ResumeNovel(ctx, key, c.opts)
+}
 
-	for i := 0; i < totalChapters; i += batchSize {
-		// 确定当前批次的结束索引
-		end := i + batchSize
-		if end > totalChapters {
-			end = totalChapters
-		}
+func runUpdate(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("update", "<小说标识|标题>")
+	key, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
+	}
+	added, err := crawler.UpdateNovel(ctx, key, c.opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("新增 %d 章\n", added)
+	return nil
+}
 
-		// 当前批次的章节
-		currentBatch := catalog.Chapters[i:end]
-		// 创建用于当前批次的通道
-		chapterChan := make(chan models.ChapterInfo, len(currentBatch))
-		resultChan := make(chan *models.Chapter, workerCount)
-		errorChan := make(chan error, workerCount)
-		doneChan := make(chan bool)
-
-		// 启动工作协程
-		for w := 0; w < workerCount; w++ {
-			go func() {
-				for chapter := range chapterChan {
-					// 随机延时，避免请求过快
-					time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
-
-					novel := &models.Novel{
-						Title: catalog.Title,
-					}
-
-					// 爬取章节内容
-					chapterContent, err := scraper.ScrapeChapter(ctx, chapter.URL, novel)
-					if err != nil {
-						errorChan <- fmt.Errorf("章节 %d 爬取失败: %v", chapter.Index, err)
-						continue
-					}
-					// 保存章节
-					if err := utils.SaveChapter(chapterContent, chapter.Index); err != nil {
-						errorChan <- fmt.Errorf("章节 %d 保存失败: %v", chapter.Index, err)
-						continue
-					}
-					// 发送结果
-					resultChan <- chapterContent
-				}
-				doneChan <- true
-			}()
-		}
+// openWorkspace 查找小说的工作目录，获取锁并修复没有写完的文件
+func openWorkspace(key string) (*utils.Workspace, func(), error) {
+	ws, err := utils.FindWorkspace(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, unlock, err := utils.LockWorkspace(context.Background(), ws)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := utils.RecoverWorkspace(ws); err != nil {
+		unlock()
+		return nil, nil, fmt.Errorf("修复工作目录失败: %v", err)
+	}
+	return ws, unlock, nil
+}
 
-		// 发送章节到工作池
-		go func() {
-			for _, chapter := range currentBatch {
-				chapterChan <- chapter
-			}
-			close(chapterChan)
-		}()
-
-		// 等待当前批次完成
-		finished := 0
-		for finished < workerCount {
-			select {
-			case err := <-errorChan:
-				log.Println("错误:", err)
-			case <-resultChan:
-				// 每完成一批就合并一次文件
-				if err := utils.MergeChapterFiles(batchSize, catalog.Title); err != nil {
-					log.Printf("合并文件失败: %v\n", err)
-				}
-			case <-doneChan:
-				finished++
-			}
+func runMerge(args []string) error {
+	fs, c := newFlagSet("merge", "<小说标识|标题>")
+	key, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
+	}
+	ws, unlock, err := openWorkspace(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	meta, err := ws.LoadMeta()
+	if err != nil || meta == nil {
+		return fmt.Errorf("读取小说信息失败: %v", err)
+	}
+	result, err := utils.MergeChapterFiles(ws, 1, meta.Title, 1)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("本次合并 %d 章，已合并到第 %d 章\n", result.Merged, result.MergedUpTo)
+	if len(result.Missing) > 0 {
+		fmt.Printf("缺失章节: %v\n", result.Missing)
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	fs, c := newFlagSet("export", "<小说标识|标题>")
+	author := fs.String("author", "", "作者，会保存到小说信息中")
+	source := fs.String("source", "", "来源链接，会保存到小说信息中")
+	format := fs.String("format", models.FormatEPUB, "导出格式：epub、html 或 md")
+	key, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
+	}
+	ws, unlock, err := openWorkspace(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if *author != "" || *source != "" {
+		if err := ws.SaveMeta(&models.NovelMeta{Author: *author, SourceURL: *source}); err != nil {
+			return fmt.Errorf("保存小说信息失败: %v", err)
 		}
 	}
+	switch *format {
+	case models.FormatEPUB:
+		return crawler.ExportEPUB(ws, c.opts.CoverPath)
+	case models.FormatHTML:
+		return crawler.ExportHTML(ws)
+	case models.FormatMarkdown:
+		return crawler.ExportMarkdown(ws)
+	}
+	return fmt.Errorf("不支持的导出格式: %s", *format)
+}
 
-	// 最终合并所有文件
-	if err := utils.MergeChapterFiles(1, catalog.Title); err != nil {
-		log.Printf("最终合并文件失败: %v\n", err)
+func runLibrary(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("请指定 library 子命令: add、remove、list 或 update")
 	}
+	action, args := args[0], args[1:]
+	switch action {
+	case "add":
+		return runLibraryAdd(args)
+	case "remove":
+		return runLibraryRemove(args)
+	case "list":
+		return runLibraryList(args)
+	case "update":
+		return runLibraryUpdate(ctx, args)
+	}
+	return fmt.Errorf("未知的 library 子命令: %s", action)
+}
 
-	log.Printf("爬取完成，共处理 %d 章节\n", totalChapters)
+func runLibraryAdd(args []string) error {
+	fs, c := newFlagSet("library add", "<目录页URL|起始章节URL>")
+	mode := fs.String("mode", models.ModeCatalog, "爬取模式：catalog 表示 URL 是目录页，follow 表示 URL 是起始章节")
+	formats := fs.String("formats", models.FormatTXT, "导出格式，多个格式用逗号分隔：txt,epub,html,md")
+	interval := fs.Duration("interval", 0, "后台模式下检查更新的间隔，0 表示使用 daemon 命令的 -interval")
+	url, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
+	}
+	entry := &models.LibraryEntry{
+		URL:     url,
+		Mode:    *mode,
+		Formats: strings.Split(*formats, ","),
+	}
+	if *interval > 0 {
+		entry.CheckInterval = interval.String()
+	}
+	if err := crawler.AddToLibrary(entry); err != nil {
+		return err
+	}
+	fmt.Printf("已将小说 %s 加入书库\n", entry.ID)
+	return nil
+}
+
+func runLibraryRemove(args []string) error {
+	fs, c := newFlagSet("library remove", "<小说标识|标题|URL>")
+	key, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
+	}
+	entry, err := crawler.RemoveFromLibrary(key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已将小说 %s 从书库中移除，工作目录 %s 中的文件保留\n", entry.ID, entry.ID)
 	return nil
 }
 
-// LoadNovelFromFirstChapterLink 根据起始章节的链接，抓取该章节的内容
-func LoadNovelFromFirstChapterLink() bool {
-	var firstChapterURL string
-	var startChapterNum int
-	var novel *models.Novel
-	if len(os.Args) > 1 {
-		firstChapterURL = os.Args[1]
-	}
-
-	firstChapterURL = "https://www.drxsw.com/book/3570239/1944073676.html"
-	startChapterNum = 1
-	novel = &models.Novel{
-		Title:    "未命名",
-		Author:   "未知",
-		Chapters: []*models.Chapter{},
-	}
-	if firstChapterURL == "" {
-		log.Fatal("请提供起始章节的URL")
-		return true
-	}
-
-	// 设置 Chrome 选项
-	opts := utils.GetChromeOptions()
-	// 检查本地是否有 Chrome，如果没有则下载到项目目录
-	if !utils.CheckChromeInstalled() {
-		log.Println("Chrome not found, downloading...")
-		if err := utils.DownloadChrome(); err != nil {
-			log.Fatal("Failed to download Chrome:", err)
+func runLibraryList(args []string) error {
+	fs, c := newFlagSet("library list", "")
+	if positional := parseArgs(fs, args); len(positional) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := c.apply(); err != nil {
+		return err
+	}
+	library, err := utils.LoadLibrary()
+	if err != nil {
+		return fmt.Errorf("读取书库失败: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "标识\t标题\t模式\t格式\t章节数\t最后检查\t")
+	for _, entry := range library.Novels {
+		checked := "未检查"
+		if entry.LastCheckedTime > 0 {
+			checked = time.Unix(entry.LastCheckedTime, 0).Format("2006-01-02 15:04")
 		}
-		// 添加自定义 Chrome 路径
-		opts = append(opts, chromedp.ExecPath(filepath.Join(".", "chrome-linux", "chrome")))
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t\n", entry.ID, entry.Title, entry.Mode,
+			strings.Join(entry.Formats, ","), entry.LastChapterCount, checked)
 	}
+	return w.Flush()
+}
 
-	// 创建一个根上下文
-	rootCtx := context.Background()
+func runLibraryUpdate(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("library update", "")
+	parallel := fs.Int("parallel", 2, "同时更新的小说数")
+	if positional := parseArgs(fs, args); len(positional) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := c.apply(); err != nil {
+		return err
+	}
+	results, err := crawler.UpdateLibrary(ctx, *parallel, c.opts)
+	if err != nil {
+		return err
+	}
 
-	// 创建浏览器实例
-	allocCtx, allocCancel := chromedp.NewExecAllocator(rootCtx, opts...)
-	defer allocCancel()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "标识\t标题\t新章节\t章节数\t状态\t")
+	for _, result := range results {
+		status := "成功"
+		if result.Err != nil {
+			status = "失败: " + result.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t\n", result.Entry.ID, result.Entry.Title,
+			result.NewChapters, result.TotalChapters, status)
+	}
+	return w.Flush()
+}
 
-	// 创建浏览器上下文
-	browserCtx, browserCancel := chromedp.NewContext(
-		allocCtx,
-		chromedp.WithLogf(log.Printf), // 添加日志记录
-	)
-	defer browserCancel()
+func runDaemon(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("daemon", "")
+	dopts := crawler.DefaultDaemonOptions()
+	fs.IntVar(&dopts.Parallel, "parallel", dopts.Parallel, "同时更新的小说数")
+	fs.DurationVar(&dopts.Interval, "interval", dopts.Interval, "默认的检查间隔")
+	fs.DurationVar(&dopts.MaxInterval, "max-interval", dopts.MaxInterval, "连续没有新章节时，检查间隔最多延长到的时间")
+	fs.Float64Var(&dopts.Jitter, "jitter", dopts.Jitter, "检查间隔的随机抖动比例")
+	if positional := parseArgs(fs, args); len(positional) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := c.apply(); err != nil {
+		return err
+	}
+	return crawler.RunDaemon(ctx, dopts, c.opts)
+}
 
-	// 设置全局超时
-	ctx, cancel := context.WithTimeout(browserCtx, 24*time.Hour) // 设置一个较长的全局超时
+func runServe(ctx context.Context, args []string) error {
+	fs, c := newFlagSet("serve", "")
+	addr := fs.String("addr", "127.0.0.1:8080", "监听地址")
+	parallel := fs.Int("parallel", 2, "同时执行的任务数")
+	if positional := parseArgs(fs, args); len(positional) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := c.apply(); err != nil {
+		return err
+	}
+
+	srv := server.New(ctx, c.opts, *parallel)
+	httpServer := &http.Server{Addr: *addr, Handler: srv.Handler()}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- httpServer.ListenAndServe()
+	}()
+	log.Printf("HTTP 接口已启动: http://%s\n", *addr)
+
+	// 收到停止信号后不再接受新的请求，等待正在执行的任务爬取完当前章节
+	select {
+	case err := <-errc:
+		return err
+	case <-crawler.Stopped(ctx):
+	case <-ctx.Done():
+	}
+	log.Println("收到停止信号，等待正在执行的任务完成")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭 HTTP 接口失败: %v\n", err)
+	}
+	srv.Wait()
+	return nil
+}
 
-	// 开始爬取章节
-	currentURL := firstChapterURL
-	var chapterNum = startChapterNum
-	var chapter *models.Chapter
-	// 抓取第一个章节，拿到初始化的信息
-	chapter, err := scraper.RetryScrapeChapter(ctx, currentURL, chapter, novel)
+func runSites(args []string) error {
+	fs, c := newFlagSet("sites", "list")
+	action, err := parseCommand(fs, c, args)
 	if err != nil {
-		log.Printf("达到最大重试次数，放弃当前章节: %v\n", err)
-		return true
-	}
-
-	// 检查是否已经爬取过这本小说
-	progress, exists := utils.CheckNovelProgress(novel)
-	if progress != nil {
-		if progress.HasError {
-			log.Printf("检测到小说《%s》上次爬取出现错误\n", progress.Title)
-			firstChapterURL = progress.LastChapterURL
-			chapterNum = progress.LastChapterNum + 1
-			log.Printf("将从上次出错的位置继续: %s\n", firstChapterURL)
-			// 抓取第一个章节，拿到初始化的信息
-			chapter, err = scraper.RetryScrapeChapter(ctx, firstChapterURL, chapter, novel)
-			if err != nil {
-				log.Printf("达到最大重试次数，放弃当前章节: %v\n", err)
-				return true
-			}
-		} else if progress.IsCompleted && exists {
-			log.Printf("检测到小说《%s》已经爬取完成\n", progress.Title)
-			log.Println("已有完整内容，退出程序")
-			return true
-		} else if exists {
-			log.Printf("检测到小说《%s》有未完成的爬取进度\n", progress.Title)
-			firstChapterURL = progress.LastChapterURL
-			chapterNum = progress.LastChapterNum + 1
-			log.Printf("将从上次爬取的位置继续: %s\n", firstChapterURL)
-			// 抓取第一个章节，拿到初始化的信息
-			chapter, err = scraper.RetryScrapeChapter(ctx, firstChapterURL, chapter, novel)
-			if err != nil {
-				log.Printf("达到最大重试次数，放弃当前章节: %v\n", err)
-				return true
-			}
+		return err
+	}
+	if action != "list" {
+		return fmt.Errorf("未知的 sites 子命令: %s", action)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\t名称\t目录页\t")
+	for _, site := range config.SiteConfigs() {
+		catalog := "否"
+		if len(site.ChapterListSelectors) > 0 {
+			catalog = "是"
 		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", site.Host, site.Name, catalog)
 	}
+	return w.Flush()
+}
 
-	// 循环的向后迭代
-	for chapter != nil && currentURL != "" {
-		var err error
-		novel.Chapters = append(novel.Chapters, chapter)
-		// 保存章节内容
-		if err := utils.SaveChapter(chapter, chapterNum); err != nil {
-			log.Printf("保存章节失败: %v\n", err)
-			utils.UpdateProgress(novel.Title, chapter.NextLink, chapterNum, true)
-			break
+func runWatermark(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("请指定 watermark 子命令: detect、apply 或 list")
+	}
+	action, args := args[0], args[1:]
+	switch action {
+	case "detect", "apply":
+	case "list":
+		return runWatermarkList(args)
+	default:
+		return fmt.Errorf("未知的 watermark 子命令: %s", action)
+	}
+
+	fs, c := newFlagSet("watermark "+action, "[小说标识|标题]")
+	wopts := scraper.DefaultWatermarkOptions()
+	fs.IntVar(&wopts.MinChapters, "min-chapters", wopts.MinChapters, "至少出现在多少个章节中")
+	fs.Float64Var(&wopts.Ratio, "ratio", wopts.Ratio, "至少出现在多少比例的章节中，总是出现在相同位置的行只需要一半")
+	selected := fs.String("select", "", "只学习这些序号的水印，多个序号用逗号分隔，默认学习所有检测到的水印")
+	positional := parseArgs(fs, args)
+	if len(positional) > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := c.apply(); err != nil {
+		return err
+	}
+	key := ""
+	if len(positional) == 1 {
+		key = positional[0]
+	}
+
+	candidates, err := crawler.DetectWatermarks(key, wopts)
+	if err != nil {
+		return err
+	}
+	if action == "detect" {
+		if len(candidates) == 0 {
+			fmt.Println("没有检测到疑似水印的行")
+			return nil
 		}
-		// 更新爬取进度
-		if err := utils.UpdateProgress(novel.Title, chapter.NextLink, chapterNum, false); err != nil {
-			log.Printf("更新进度失败: %v\n", err)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "序号\t章节\t位置\t小说\t内容\t")
+		for i, candidate := range candidates {
+			content := candidate.Example
+			if candidate.Rule.Pattern != "" {
+				content += "（正则: " + candidate.Rule.Pattern + "）"
+			}
+			fmt.Fprintf(w, "%d\t%d/%d\t%s\t%s\t%s\t\n", i+1, candidate.Chapters, candidate.Total,
+				candidate.Position, strings.Join(candidate.Novels, ","), content)
 		}
+		return w.Flush()
+	}
 
-		// 每爬取10章就合并一次文件
-		if err := utils.MergeChapterFiles(10, novel.Title); err != nil {
-			log.Printf("合并文件失败: %v\n", err)
-			// 标记错误状态但继续尝试
-			utils.UpdateProgress(novel.Title, chapter.NextLink, chapterNum, true)
+	var rules []models.WatermarkRule
+	if *selected == "" {
+		for _, candidate := range candidates {
+			rules = append(rules, candidate.Rule)
 		}
-
-		// 更新URL到下一章
-		currentURL = chapter.NextLink
-		chapterNum++
-		if currentURL != "" {
-			// 随机延时 1-30 微秒，避免请求过快
-			sleepTime := time.Duration(1+rand.Intn(30)) * time.Microsecond
-			log.Printf("等待 %v 后继续爬取下一章...\n", sleepTime)
-			time.Sleep(sleepTime)
-			// 添加重试机制
-			chapter, err = scraper.RetryScrapeChapter(ctx, currentURL, chapter, novel)
-			if err != nil {
-				log.Printf("达到最大重试次数，放弃当前章节: %v\n", err)
-				break
+	} else {
+		for _, s := range strings.Split(*selected, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n < 1 || n > len(candidates) {
+				return fmt.Errorf("无效的序号: %s", s)
 			}
+			rules = append(rules, candidates[n-1].Rule)
+		}
+	}
+	added, err := crawler.LearnWatermarks(rules)
+	if err != nil {
+		return fmt.Errorf("保存水印规则失败: %v", err)
+	}
+	fmt.Printf("新学习了 %d 条水印规则\n", added)
+
+	results, err := crawler.RemoveWatermarks(ctx, key)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "标识\t标题\t修改章节\t状态\t")
+	for _, result := range results {
+		status := "成功"
+		if result.Err != nil {
+			status = "失败: " + result.Err.Error()
 		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t\n", result.ID, result.Title, result.Changed, status)
 	}
+	return w.Flush()
+}
 
-	// 合并所有剩余的章节文件
-	if err := utils.MergeChapterFiles(1, novel.Title); err != nil {
-		log.Printf("最终合并文件失败: %v\n", err)
+func runWatermarkList(args []string) error {
+	fs, c := newFlagSet("watermark list", "")
+	if positional := parseArgs(fs, args); len(positional) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := c.apply(); err != nil {
+		return err
+	}
+	watermarks, err := utils.LoadWatermarks()
+	if err != nil {
+		return fmt.Errorf("读取水印规则失败: %v", err)
 	}
 
-	log.Printf("爬取完成，共爬取 %d 章节\n", chapterNum-1)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "序号\t网站\t来源\t加入时间\t规则\t")
+	for i, rule := range watermarks.Rules {
+		content := rule.Text
+		if rule.Pattern != "" {
+			content = "正则: " + rule.Pattern
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t\n", i+1, rule.Host, rule.Source,
+			time.Unix(rule.AddedTime, 0).Format("2006-01-02 15:04"), content)
+	}
+	return w.Flush()
+}
+
+func runCache(args []string) error {
+	fs, c := newFlagSet("cache", "stats|clear")
+	pageType := fs.String("type", "", "只清空这种页面的缓存：catalog 或 chapter，默认清空所有页面")
+	action, err := parseCommand(fs, c, args)
+	if err != nil {
+		return err
+	}
+	cache := fetcher.Cache()
+	if cache == nil {
+		return fmt.Errorf("没有使用页面缓存")
+	}
 
-	// 标记完成状态
-	if progress != nil {
-		utils.UpdateProgress(progress.Title, currentURL, chapterNum, false)
+	switch action {
+	case "stats":
+		stats, err := cache.Stats()
+		if err != nil {
+			return fmt.Errorf("统计页面缓存失败: %v", err)
+		}
+		fmt.Printf("缓存目录: %s\n", cache.Dir)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "页面类型\t页面数\t已过期\t有效期\t")
+		for _, t := range fetcher.PageTypes {
+			ttl := "永不过期"
+			if cache.TTLs[t] > 0 {
+				ttl = cache.TTLs[t].String()
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t\n", t, stats.Pages[t], stats.Expired[t], ttl)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("页面内容: %d 个文件，共 %.1f MB\n", stats.Objects, float64(stats.Bytes)/(1<<20))
+		return nil
+	case "clear":
+		if *pageType != "" && *pageType != fetcher.PageCatalog && *pageType != fetcher.PageChapter {
+			return fmt.Errorf("未知的页面类型: %s", *pageType)
+		}
+		removed, err := cache.Clear(*pageType)
+		if err != nil {
+			return fmt.Errorf("清空页面缓存失败: %v", err)
+		}
+		fmt.Printf("已删除 %d 个缓存的页面\n", removed)
+		return nil
 	}
-	return false
+	return fmt.Errorf("未知的 cache 子命令: %s", action)
 }